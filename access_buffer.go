@@ -0,0 +1,92 @@
+package gokachu
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// accessStripeSize is the number of accesses a stripe holds before Get asks for a drain.
+const accessStripeSize = 64
+
+// accessBuffer records the accesses of Get, which only holds the read lock, so that they can be applied to the eviction
+// policy in batches under the write lock.
+//
+// Accesses are spread over stripes to avoid contention between cores. Recording is lossy: an access is dropped if its
+// stripe is busy or full. A policy only loses a little precision by this, while Get never waits for a writer.
+type accessBuffer[K comparable] struct {
+	stripes []accessStripe[K]
+	mask    uint64
+	dirty   atomic.Bool // true if any stripe may hold accesses
+}
+
+type accessStripe[K comparable] struct {
+	mut  sync.Mutex
+	keys []K
+	_    [32]byte // keeps stripes on separate cache lines
+}
+
+func newAccessBuffer[K comparable]() *accessBuffer[K] {
+	stripes := 1 << bits.Len(uint(runtime.GOMAXPROCS(0)-1)) // next power of two
+
+	return &accessBuffer[K]{
+		stripes: make([]accessStripe[K], stripes),
+		mask:    uint64(stripes - 1),
+	}
+}
+
+// record records an access of the key. The read lock of the cache must be held.
+// Returns true if the stripe is full, so the buffer should be drained.
+func (b *accessBuffer[K]) record(key K) bool {
+	stripe := &b.stripes[rand.Uint64()&b.mask]
+
+	if !stripe.mut.TryLock() {
+		return false // busy stripe, drop the access
+	}
+
+	full := len(stripe.keys) >= accessStripeSize
+	if !full {
+		if stripe.keys == nil {
+			stripe.keys = make([]K, 0, accessStripeSize)
+		}
+
+		stripe.keys = append(stripe.keys, key) // a full stripe drops the access
+		full = len(stripe.keys) == accessStripeSize
+	}
+
+	stripe.mut.Unlock()
+
+	if !b.dirty.Load() {
+		b.dirty.Store(true)
+	}
+
+	return full
+}
+
+// drain calls fn for every recorded access in the order of recording within a stripe and empties the buffer.
+// The write lock of the cache must be held, so no access is recorded meanwhile.
+func (b *accessBuffer[K]) drain(fn func(key K)) {
+	if !b.dirty.Load() {
+		return
+	}
+
+	for i := range b.stripes {
+		stripe := &b.stripes[i]
+
+		for _, key := range stripe.keys {
+			fn(key)
+		}
+
+		clear(stripe.keys)
+		stripe.keys = stripe.keys[:0]
+	}
+
+	b.dirty.Store(false)
+}
+
+// pending reports whether the buffer may hold accesses.
+func (b *accessBuffer[K]) pending() bool {
+	return b.dirty.Load()
+}
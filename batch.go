@@ -0,0 +1,184 @@
+package gokachu
+
+import (
+	"context"
+	"time"
+)
+
+// BulkLoader loads the values of missing keys with a single call. Keys missing from the returned map are left missing.
+// The returned duration is used as the TTL of every loaded value.
+type BulkLoader[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, time.Duration, error)
+
+// SetMany sets values in the cache with a TTL like Set, taking the lock and making room for the new values once.
+// Values of the batch are not evicted to make room for each other, so the cache may exceed its limits if the batch does not fit.
+func (g *Gokachu[K, V]) SetMany(items map[K]V, ttl time.Duration) {
+	defer g.lock()()
+
+	if g.pollCancel == nil {
+		return
+	}
+
+	type entry struct {
+		key        K
+		value      V
+		cost, size int64
+	}
+
+	entries := make([]entry, 0, len(items))
+	count, cost, size := 0, int64(0), int64(0)
+
+	for key, v := range items {
+		g.runOnSetHooks(key, v, ttl)
+
+		e := entry{key: key, value: v, cost: g.weigh(key, v), size: g.sizer(key, v)}
+		entries = append(entries, e)
+
+		if _, ok := g.store[key]; !ok {
+			count++
+			cost += e.cost
+			size += e.size
+		}
+	}
+
+	g.applyAccesses()
+
+	protected := func(k K) bool {
+		_, ok := items[k]
+		return ok
+	}
+
+	// clear if the new values do not fit
+	g.makeRoom(protected, count, cost, size)
+
+	exp := expireTime(ttl)
+
+	for _, e := range entries {
+		g.put(e.key, e.value, exp, ttl, e.cost, e.size, nil)
+	}
+
+	// clear if the new cost or size of the existing values does not fit
+	g.makeRoom(protected, 0, 0, 0)
+}
+
+// GetMany gets the values of the keys like Get, taking the lock once. Missing and expired keys are left out of the result.
+func (g *Gokachu[K, V]) GetMany(keys []K) map[K]V {
+	values, drain := g.getMany(keys)
+	if drain {
+		g.drainAccesses()
+	}
+
+	return values
+}
+
+// getMany looks the keys up under the read lock and runs the OnGet or OnMiss hooks.
+// Returns true in second value if the access buffer asks for a drain.
+func (g *Gokachu[K, V]) getMany(keys []K) (map[K]V, bool) {
+	g.mut.RLock()
+	defer g.mut.RUnlock()
+
+	values := make(map[K]V, len(keys))
+	now := time.Now()
+	drain := false
+
+	for _, key := range keys {
+		value, ok := g.store[key]
+		if !ok || value.expired(now) {
+			// expired values are left to the poll, they cannot be deleted under the read lock
+			g.runOnMissHooks(key)
+			continue
+		}
+
+		value.hitCount.Add(1)
+
+		if g.accesses == nil {
+			g.policy.OnAccess(key)
+		} else if g.accesses.record(key) {
+			drain = true
+		}
+
+		g.runOnGetHooks(key, value.value)
+
+		if value.hook.OnGet != nil {
+			value.hook.OnGet()
+		}
+
+		values[key] = value.value
+	}
+
+	return values, drain
+}
+
+// DeleteMany deletes the values of the keys like Delete, taking the lock once, and returns the number of deleted values.
+func (g *Gokachu[K, V]) DeleteMany(keys []K) int {
+	defer g.lock()()
+
+	count := 0
+
+	for _, key := range keys {
+		if value, ok := g.store[key]; ok {
+			g.remove(value, EvictionReasonDeleted)
+
+			count++
+		}
+	}
+
+	return count
+}
+
+// GetOrLoadMany gets the values of the keys, and loads the missing ones with a single call of the bulk loader.
+// Loaded values are set into the cache with SetMany. If loader is nil, missing keys are loaded one by one with GetOrLoad
+// and the loader of WithLoader. The loader's error is returned as is and nothing is set into the cache.
+//
+// Unlike GetOrLoad, concurrent bulk loads of the same keys are not merged.
+func (g *Gokachu[K, V]) GetOrLoadMany(ctx context.Context, keys []K, loader BulkLoader[K, V]) (map[K]V, error) {
+	return getOrLoadMany(ctx, g, keys, loader)
+}
+
+// batchCache is implemented by Gokachu and Sharded.
+type batchCache[K comparable, V any] interface {
+	GetMany(keys []K) map[K]V
+	SetMany(items map[K]V, ttl time.Duration)
+	GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error)
+}
+
+func getOrLoadMany[K comparable, V any](ctx context.Context, c batchCache[K, V], keys []K, loader BulkLoader[K, V]) (map[K]V, error) {
+	values := c.GetMany(keys)
+
+	missing := make([]K, 0, len(keys)-len(values))
+
+	for _, key := range keys {
+		if _, ok := values[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		return values, nil
+	}
+
+	if loader == nil {
+		for _, key := range missing {
+			v, err := c.GetOrLoad(ctx, key, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			values[key] = v
+		}
+
+		return values, nil
+	}
+
+	loaded, ttl, err := loader(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetMany(loaded, ttl)
+
+	for key, v := range loaded {
+		values[key] = v
+	}
+
+	return values, nil
+}
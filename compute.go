@@ -0,0 +1,106 @@
+package gokachu
+
+import "time"
+
+// ComputeOp tells Compute what to do with the result of the compute function.
+type ComputeOp int
+
+const (
+	ComputeKeep   ComputeOp = iota // leave the entry as it is, the new value is ignored
+	ComputeSet                     // set the new value with the returned TTL, like Set
+	ComputeUpdate                  // set the new value and keep the expiry of an existing entry; a new entry gets the returned TTL
+	ComputeDelete                  // delete the entry, like Delete
+)
+
+// ComputeFunc computes the new value of an entry from its current value. exists is false if the key does not exist
+// or is expired, then old is the zero value. The returned TTL is used by ComputeSet and ComputeUpdate.
+type ComputeFunc[V any] func(old V, exists bool) (V, time.Duration, ComputeOp)
+
+// Computer is a cache with atomic read-modify-write. It is implemented by Gokachu and Sharded.
+type Computer[K comparable, V any] interface {
+	Compute(key K, fn ComputeFunc[V]) (V, bool)
+}
+
+// Integer is a constraint for the values of Increment.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Compute reads, computes and writes the entry of the key atomically, so concurrent updates are not lost.
+// It returns the value of the entry after the operation and false if the entry does not exist any more.
+// Set and delete hooks run as for Set and Delete.
+//
+// fn runs with the write lock held, so it must not call methods of the cache; doing so deadlocks.
+func (g *Gokachu[K, V]) Compute(key K, fn ComputeFunc[V]) (V, bool) {
+	defer g.lock()()
+
+	if g.pollCancel == nil {
+		return *new(V), false
+	}
+
+	value, exists := g.lookup(key)
+
+	var old V
+	if exists {
+		old = value.value
+	}
+
+	newValue, ttl, op := fn(old, exists)
+
+	switch op {
+	case ComputeSet:
+		g.set(key, newValue, ttl, g.weigh(key, newValue), nil)
+	case ComputeUpdate:
+		if exists {
+			g.update(value, newValue)
+		} else {
+			g.set(key, newValue, ttl, g.weigh(key, newValue), nil)
+		}
+	case ComputeDelete:
+		if exists {
+			g.remove(value, EvictionReasonDeleted)
+		}
+
+		return *new(V), false
+	default:
+		return old, exists
+	}
+
+	return newValue, true
+}
+
+// Update sets the value of the key to the result of fn atomically and keeps its expiry. Nothing is set if the key does
+// not exist or is expired. Returns the new value and true if the value was updated. See Compute for the locking rules.
+func (g *Gokachu[K, V]) Update(key K, fn func(old V) V) (V, bool) {
+	return g.Compute(key, func(old V, exists bool) (V, time.Duration, ComputeOp) {
+		if !exists {
+			return old, 0, ComputeKeep
+		}
+
+		return fn(old), 0, ComputeUpdate
+	})
+}
+
+// GetAndDelete deletes the value of the key like Delete and returns it. Returns false in second value if the key does not exist or is expired.
+func (g *Gokachu[K, V]) GetAndDelete(key K) (V, bool) {
+	defer g.lock()()
+
+	value, ok := g.lookup(key)
+	if !ok {
+		return *new(V), false
+	}
+
+	g.remove(value, EvictionReasonDeleted)
+
+	return value.value, true
+}
+
+// Increment adds delta to the integer value of the key atomically and returns the new value. A missing or expired key
+// starts from 0 and gets the given TTL; an existing key keeps its expiry.
+func Increment[K comparable, V Integer](c Computer[K, V], key K, delta V, ttl time.Duration) V {
+	value, _ := c.Compute(key, func(old V, _ bool) (V, time.Duration, ComputeOp) {
+		return old + delta, ttl, ComputeUpdate
+	})
+
+	return value
+}
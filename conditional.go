@@ -0,0 +1,96 @@
+package gokachu
+
+import "time"
+
+// SetIfAbsent sets a value like Set, but only if the key does not exist or is expired. Returns true if the value was set.
+func (g *Gokachu[K, V]) SetIfAbsent(key K, v V, ttl time.Duration, hooks ...Hook) bool {
+	defer g.lock()()
+
+	if _, ok := g.lookup(key); ok || g.pollCancel == nil {
+		return false
+	}
+
+	g.set(key, v, ttl, g.weigh(key, v), hooks)
+
+	return true
+}
+
+// Replace sets a value like Set, but only if the key exists and is not expired. Returns true if the value was set.
+func (g *Gokachu[K, V]) Replace(key K, v V, ttl time.Duration, hooks ...Hook) bool {
+	defer g.lock()()
+
+	if _, ok := g.lookup(key); !ok {
+		return false
+	}
+
+	g.set(key, v, ttl, g.weigh(key, v), hooks)
+
+	return true
+}
+
+// CompareAndSwap sets the value of the key to newValue if its current value equals oldValue according to eq.
+// The expiry of the value does not change. If eq is nil, values are compared with ==, which panics if V is not comparable.
+// Returns true if the value was swapped.
+func (g *Gokachu[K, V]) CompareAndSwap(key K, oldValue, newValue V, eq func(a, b V) bool) bool {
+	defer g.lock()()
+
+	value, ok := g.lookup(key)
+	if !ok || !equal(value.value, oldValue, eq) {
+		return false
+	}
+
+	g.update(value, newValue)
+
+	return true
+}
+
+// CompareAndDelete deletes the value of the key if it equals oldValue according to eq, like Delete.
+// If eq is nil, values are compared with ==, which panics if V is not comparable. Returns true if the value was deleted.
+func (g *Gokachu[K, V]) CompareAndDelete(key K, oldValue V, eq func(a, b V) bool) bool {
+	defer g.lock()()
+
+	value, ok := g.lookup(key)
+	if !ok || !equal(value.value, oldValue, eq) {
+		return false
+	}
+
+	g.remove(value, EvictionReasonDeleted)
+
+	return true
+}
+
+// update sets a new value of an existing entry like Set, but keeps its expiry. The write lock must be held.
+func (g *Gokachu[K, V]) update(value *valueWithTTL[K, V], v V) {
+	exp, ttl := value.expireTime, value.ttl
+
+	remaining := time.Duration(0)
+	if !exp.IsZero() {
+		remaining = max(time.Until(exp), time.Nanosecond)
+	}
+
+	g.set(value.key, v, remaining, g.weigh(value.key, v), nil)
+
+	// keep the exact expiry instead of the one computed by set
+	value.expireTime, value.ttl = exp, ttl
+	g.expirations.update(value)
+}
+
+// lookup returns the value of the key. An expired value is deleted and reported as missing. The write lock must be held.
+func (g *Gokachu[K, V]) lookup(key K) (*valueWithTTL[K, V], bool) {
+	value, ok := g.store[key]
+	if ok && value.expired(time.Now()) {
+		g.deleteExpired(value)
+		return nil, false
+	}
+
+	return value, ok
+}
+
+// equal compares two values with eq, or with == if eq is nil.
+func equal[V any](a, b V, eq func(a, b V) bool) bool {
+	if eq == nil {
+		return any(a) == any(b)
+	}
+
+	return eq(a, b)
+}
@@ -0,0 +1,46 @@
+package gokachu
+
+import "iter"
+
+// EvictionPolicy decides which key is evicted when the cache is full.
+//
+// The cache calls the methods with its write lock held, except Keys, which is called with the read lock held by Keys,
+// KeysFunc, All, Items and snapshots, possibly from several goroutines at once. Keys must therefore only read the policy;
+// the other methods need no synchronization of their own. An instance belongs to a single cache; WithEvictionPolicy takes
+// a factory for this reason.
+type EvictionPolicy[K comparable] interface {
+	// OnInsert is called when a new key is set.
+	OnInsert(key K)
+	// OnAccess is called when an existing key is read by Get. Reads are recorded and passed in batches before the next write
+	// that depends on the order, so a read may be reported late or, under heavy contention, not at all.
+	OnAccess(key K)
+	// OnUpdate is called when an existing key is overwritten by Set.
+	OnUpdate(key K)
+	// OnRemove is called when a key leaves the cache for any reason, including eviction of a victim.
+	OnRemove(key K)
+	// Victim returns the key to be evicted next. Returns false if the policy has no keys.
+	// The key is not removed until OnRemove is called.
+	Victim() (K, bool)
+	// Keys returns all keys in eviction order, the next victim first. It is called under the read lock and must be safe
+	// for concurrent read-only use.
+	Keys() iter.Seq[K]
+}
+
+// concurrentAccessPolicy is implemented by built-in policies whose OnAccess is safe to call concurrently and does not
+// change the structure of the policy. Get calls OnAccess of such policies directly under the read lock instead of recording it.
+type concurrentAccessPolicy interface {
+	concurrentAccess()
+}
+
+// evictingPolicy is implemented by built-in policies which remember evicted keys. The cache calls evicting with the key
+// it is about to evict, right before OnRemove, which differs from the key returned by Victim if that key is protected.
+type evictingPolicy[K comparable] interface {
+	evicting(key K)
+}
+
+// restorer is implemented by built-in policies which can put a key restored from a snapshot back to its place in eviction order.
+// Other policies see restored keys as inserted in eviction order.
+type restorer[K comparable] interface {
+	// restore moves an existing key behind all other keys in eviction order with the given number of hits.
+	restore(key K, hits uint64)
+}
@@ -0,0 +1,35 @@
+package gokachu
+
+// EvictionReason tells why a value left the cache. It is passed to the hooks added with AddOnEvictHook.
+type EvictionReason uint
+
+const (
+	EvictionReasonDeleted     EvictionReason = iota // Deleted by Delete
+	EvictionReasonDeletedFunc                       // Deleted by a DeleteFunc match
+	EvictionReasonExpired                           // TTL expired
+	EvictionReasonCapacity                          // Evicted by the replacement strategy because the cache is full
+	EvictionReasonReplaced                          // Overwritten by Set. The hook receives the old value.
+	EvictionReasonFlushed                           // Deleted by Flush
+	EvictionReasonClosed                            // Deleted by Close
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionReasonDeleted:
+		return "deleted"
+	case EvictionReasonDeletedFunc:
+		return "deleted_func"
+	case EvictionReasonExpired:
+		return "expired"
+	case EvictionReasonCapacity:
+		return "capacity"
+	case EvictionReasonReplaced:
+		return "replaced"
+	case EvictionReasonFlushed:
+		return "flushed"
+	case EvictionReasonClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,72 @@
+package gokachu
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expirationHeap is a min-heap of values with TTL ordered by expire time. Values without TTL are not in the heap.
+type expirationHeap[K comparable, V any] []*valueWithTTL[K, V]
+
+func (h expirationHeap[K, V]) Len() int { return len(h) }
+
+func (h expirationHeap[K, V]) Less(i, j int) bool { return h[i].expireTime.Before(h[j].expireTime) }
+
+func (h expirationHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expirationHeap[K, V]) Push(x any) {
+	value := x.(*valueWithTTL[K, V])
+	value.heapIndex = len(*h)
+	*h = append(*h, value)
+}
+
+func (h *expirationHeap[K, V]) Pop() any {
+	old := *h
+	n := len(old)
+	value := old[n-1]
+	old[n-1] = nil
+	value.heapIndex = -1
+	*h = old[:n-1]
+
+	return value
+}
+
+// peek returns the value which expires first, or nil if the heap is empty.
+func (h expirationHeap[K, V]) peek() *valueWithTTL[K, V] {
+	if len(h) == 0 {
+		return nil
+	}
+
+	return h[0]
+}
+
+// update puts the value into its place according to its current expire time. It adds or removes the value when needed.
+func (h *expirationHeap[K, V]) update(value *valueWithTTL[K, V]) {
+	switch {
+	case value.expireTime.IsZero() && value.heapIndex >= 0:
+		heap.Remove(h, value.heapIndex)
+	case value.expireTime.IsZero():
+	case value.heapIndex >= 0:
+		heap.Fix(h, value.heapIndex)
+	default:
+		heap.Push(h, value)
+	}
+}
+
+// remove removes the value from the heap if it is in the heap.
+func (h *expirationHeap[K, V]) remove(value *valueWithTTL[K, V]) {
+	if value.heapIndex >= 0 {
+		heap.Remove(h, value.heapIndex)
+	}
+}
+
+// hasExpired reports whether at least one value in the heap is expired at the given time.
+func (h expirationHeap[K, V]) hasExpired(now time.Time) bool {
+	first := h.peek()
+
+	return first != nil && first.expired(now)
+}
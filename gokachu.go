@@ -2,7 +2,9 @@ package gokachu
 
 import (
 	"cmp"
-	"container/list"
+	"errors"
+	"fmt"
+	"iter"
 	"slices"
 	"sync"
 	"sync/atomic"
@@ -10,15 +12,31 @@ import (
 )
 
 type Gokachu[K comparable, V any] struct {
-	elems               *list.List // front of list == greater risk of deletion <---------list---------> back of list == less risk of deletion
-	store               map[K]*list.Element
-	mut                 *sync.RWMutex
-	maxRecordThreshold  int
-	clearNum            int
-	replacementStrategy ReplacementStrategy
-	pollInterval        time.Duration
-	pollCancel          chan struct{}
-	wg                  *sync.WaitGroup
+	policy             EvictionPolicy[K] // keeps the eviction order of keys
+	evictable          bool              // false if the policy is never asked for a victim
+	accesses           *accessBuffer[K]  // accesses of Get waiting for the write lock, nil if the policy is called directly, see concurrentAccessPolicy
+	store              map[K]*valueWithTTL[K, V]
+	expirations        expirationHeap[K, V]
+	mut                *sync.RWMutex
+	maxRecordThreshold int
+	clearNum           int
+	lowWatermark       int
+	maxCost            int64
+	weigher            func(key K, value V) int64
+	cost               int64 // total cost of the values in the store
+	maxMemory          int64
+	sizer              func(key K, value V) int64
+	memory             int64 // approximate heap footprint of the store
+	silentCapacity     bool
+	silentFlush        bool
+	silentClose        bool
+	pollInterval       time.Duration
+	pollCancel         chan struct{}
+	wg                 *sync.WaitGroup
+	loader             Loader[K, V]
+	loadMut            *sync.Mutex
+	loads              map[K]*loadCall[V] // in-flight loads of GetOrLoad
+	persister          persister[K, V]
 
 	// Hooks
 	inc           atomic.Uint64
@@ -26,38 +44,258 @@ type Gokachu[K comparable, V any] struct {
 	onGetHooks    map[uint64]func(key K, value V)
 	onMissHooks   map[uint64]func(key K)
 	onDeleteHooks map[uint64]func(key K, value V)
+	onEvictHooks  map[uint64]func(key K, value V, reason EvictionReason)
 }
 
+// Config configures a cache. The parts that depend on the key and value types are set with options, see Option.
 type Config struct {
-	ReplacementStrategy ReplacementStrategy // default: ReplacementStrategyNone
+	ReplacementStrategy ReplacementStrategy // default: ReplacementStrategyNone, New falls back to ReplacementStrategyLRU if a limit is set
 	MaxRecordThreshold  int                 // This parameter is used to control the maximum number of records in the cache. If the number of records exceeds this threshold, records will be deleted according to the replacement strategy.
-	ClearNum            int                 // This parameter is used to control the number of records to be deleted.
+	ClearNum            int                 // This parameter is used to control the number of records to be deleted. If value is 0, LowWatermarkPercent decides.
+	LowWatermarkPercent int                 // If set, records are deleted until N percent of MaxRecordThreshold is left. If both ClearNum and this are 0, one record is deleted for each new one.
 	PollInterval        time.Duration       // This parameter is used to control the polling interval. If value is 0, uses default = 1 second.
+
+	// MaxCost is used to control the maximum total cost of the values in the cache. If a Set exceeds it, records are deleted
+	// according to the replacement strategy until the total cost fits. It works together with MaxRecordThreshold. If value is 0, cost is not limited.
+	// The cost of a value is 1 unless WithWeigher or SetWithCost says otherwise.
+	MaxCost int64
+	// MaxMemoryBytes is used to control the approximate heap footprint of the cache. If a Set exceeds it, records are deleted
+	// according to the replacement strategy until it fits. Values implementing Sizer report their own size, see MemoryBytes for the estimation of others.
+	// If value is 0, memory is not limited.
+	MaxMemoryBytes int64
+
+	// PersistPath is a file the cache is saved to on Close and every PersistInterval, and loaded from by New.
+	// The file is replaced atomically, so a failed save leaves the previous one intact. If value is empty, the cache is not persisted.
+	PersistPath string
+	// PersistInterval is used to control the interval of saves. If value is 0, the cache is only saved on Close.
+	PersistInterval time.Duration
+	// OnPersistError is called with the errors of loading and saving the file, since New and Close do not return errors.
+	// A corrupt file or a file of another format version is reported with ErrInvalidSnapshot, and the cache starts empty.
+	// It may be called from a background goroutine. If it is nil, errors are ignored.
+	OnPersistError func(err error)
+	// OnConfigError is called by New and NewSharded with the error of Config.Validate if they fall back from invalid settings,
+	// see New. It matches ErrInvalidConfig. If it is nil, the fallbacks are silent.
+	OnConfigError func(err error)
+
+	// OnDelete hooks (global and individual) run for every removed value by default. These parameters silence them for a removal path.
+	// OnEvict hooks always run, so the removal can still be observed with its reason.
+	SilentCapacityEviction bool // If true, OnDelete hooks do not run for values evicted by the replacement strategy.
+	SilentFlush            bool // If true, OnDelete hooks do not run for values deleted by Flush.
+	SilentClose            bool // If true, OnDelete hooks do not run for values deleted by Close.
+}
+
+// ErrInvalidConfig is returned by Config.Validate and NewStrict for a configuration that cannot work as intended.
+var ErrInvalidConfig = errors.New("gokachu: invalid config")
+
+// Validate reports whether the configuration is usable. Limits without a replacement strategy are rejected,
+// since nothing could be evicted to enforce them. A custom eviction policy set by WithEvictionPolicy is not seen here;
+// NewStrict takes it into account.
+func (cfg Config) Validate() error {
+	return cfg.validate(false)
 }
 
-// New creates a new Gokachu instance with the given configuration. Do not forgot call Close() function before exit.
-func New[K comparable, V any](cfg Config) *Gokachu[K, V] {
+// validate is Validate, where customPolicy reports whether an eviction policy is set by WithEvictionPolicy.
+func (cfg Config) validate(customPolicy bool) error {
+	var errs []error
+
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.ReplacementStrategy > ReplacementStrategyCLOCK {
+		invalid("unknown replacement strategy %d", cfg.ReplacementStrategy)
+	}
+
+	if cfg.MaxRecordThreshold < 0 {
+		invalid("MaxRecordThreshold must not be negative")
+	}
+
+	if cfg.ClearNum < 0 {
+		invalid("ClearNum must not be negative")
+	}
+
+	if cfg.LowWatermarkPercent < 0 || cfg.LowWatermarkPercent >= 100 {
+		invalid("LowWatermarkPercent must be between 0 and 99")
+	}
+
+	if cfg.ClearNum > 0 && cfg.LowWatermarkPercent > 0 {
+		invalid("ClearNum and LowWatermarkPercent are mutually exclusive")
+	}
+
+	if cfg.MaxRecordThreshold == 0 && (cfg.ClearNum > 0 || cfg.LowWatermarkPercent > 0) {
+		invalid("ClearNum and LowWatermarkPercent require MaxRecordThreshold")
+	}
+
+	if cfg.MaxCost < 0 {
+		invalid("MaxCost must not be negative")
+	}
+
+	if cfg.MaxMemoryBytes < 0 {
+		invalid("MaxMemoryBytes must not be negative")
+	}
+
+	if cfg.PollInterval < 0 {
+		invalid("PollInterval must not be negative")
+	}
+
+	if cfg.PersistInterval < 0 {
+		invalid("PersistInterval must not be negative")
+	}
+
+	if cfg.PersistInterval > 0 && cfg.PersistPath == "" {
+		invalid("PersistInterval requires PersistPath")
+	}
+
+	limited := cfg.MaxRecordThreshold > 0 || cfg.MaxCost > 0 || cfg.MaxMemoryBytes > 0
+	if limited && cfg.ReplacementStrategy == ReplacementStrategyNone && !customPolicy {
+		invalid("a capacity limit requires a replacement strategy or an eviction policy")
+	}
+
+	if limited && cfg.MaxRecordThreshold == 0 && cfg.ReplacementStrategy.sizedByThreshold() && !customPolicy {
+		invalid("W-TinyLFU, ARC, S3-FIFO and 2Q size their queues by MaxRecordThreshold, so they require it with MaxCost or MaxMemoryBytes")
+	}
+
+	return errors.Join(errs...)
+}
+
+// usable returns the configuration with the fallbacks of New for the settings rejected by validate, and reports them
+// to OnConfigError.
+func (cfg Config) usable(customPolicy bool) Config {
+	if err := cfg.validate(customPolicy); err != nil && cfg.OnConfigError != nil {
+		cfg.OnConfigError(err)
+	}
+
+	cfg.MaxRecordThreshold = max(cfg.MaxRecordThreshold, 0)
+	cfg.ClearNum = max(cfg.ClearNum, 0)
+	cfg.MaxCost = max(cfg.MaxCost, 0)
+	cfg.MaxMemoryBytes = max(cfg.MaxMemoryBytes, 0)
+	cfg.PollInterval = max(cfg.PollInterval, 0)
+	cfg.PersistInterval = max(cfg.PersistInterval, 0)
+
+	if cfg.LowWatermarkPercent < 0 || cfg.LowWatermarkPercent >= 100 || cfg.ClearNum > 0 {
+		cfg.LowWatermarkPercent = 0
+	}
+
+	if cfg.PersistPath == "" {
+		cfg.PersistInterval = 0
+	}
+
+	if customPolicy {
+		return cfg
+	}
+
+	limited := cfg.MaxRecordThreshold > 0 || cfg.MaxCost > 0 || cfg.MaxMemoryBytes > 0
+
+	switch {
+	case cfg.ReplacementStrategy > ReplacementStrategyCLOCK:
+		cfg.ReplacementStrategy = ReplacementStrategyNone
+		if limited {
+			cfg.ReplacementStrategy = ReplacementStrategyLRU
+		}
+	case cfg.ReplacementStrategy == ReplacementStrategyNone && limited:
+		cfg.ReplacementStrategy = ReplacementStrategyLRU
+	case cfg.ReplacementStrategy.sizedByThreshold() && cfg.MaxRecordThreshold == 0 && limited:
+		cfg.ReplacementStrategy = ReplacementStrategyLRU
+	}
+
+	return cfg
+}
+
+// New creates a new Gokachu instance with the given configuration and options. Do not forgot call Close() function before exit.
+// If Config.PersistPath is set, the cache is loaded from it.
+//
+// New accepts any configuration and falls back from the settings Config.Validate reports:
+//   - Without a custom eviction policy, a limit is enforced with ReplacementStrategyLRU if the replacement strategy is
+//     ReplacementStrategyNone or unknown, or if it is W-TinyLFU, ARC, S3-FIFO or 2Q without MaxRecordThreshold.
+//     An unknown replacement strategy without a limit is ReplacementStrategyNone.
+//   - Negative or out of range values are ignored as if they were 0, and ClearNum wins over LowWatermarkPercent.
+//   - PersistInterval is ignored without PersistPath.
+//
+// The error of Config.Validate is passed to Config.OnConfigError. Use NewStrict to get it instead.
+func New[K comparable, V any](cfg Config, opts ...Option[K, V]) *Gokachu[K, V] {
+	o := newOptions(opts)
+
+	g := newGokachu(cfg.usable(o.evictionPolicy != nil), o)
+	g.start()
+
+	return g
+}
+
+// NewStrict creates a new Gokachu instance like New, but returns an error matching ErrInvalidConfig if the configuration
+// cannot work as intended, see Config.Validate.
+func NewStrict[K comparable, V any](cfg Config, opts ...Option[K, V]) (*Gokachu[K, V], error) {
+	o := newOptions(opts)
+
+	if err := cfg.validate(o.evictionPolicy != nil); err != nil {
+		return nil, err
+	}
+
+	g := newGokachu(cfg, o)
+	g.start()
+
+	return g, nil
+}
+
+// start loads the persisted values and starts the poll goroutines of a cache created by newGokachu.
+func (g *Gokachu[K, V]) start() {
+	if g.persister.enabled() {
+		g.restore(g.persister.load())
+	}
+
+	g.wg.Add(1)
+
+	go poll(g.pollInterval, g.pollCancel, g.wg, g.expire)
+
+	if g.persister.interval > 0 {
+		g.wg.Add(1)
+
+		go poll(g.persister.interval, g.pollCancel, g.wg, func() { g.persister.save(g.records()) })
+	}
+}
+
+// newGokachu creates a cache without starting its poll goroutine. The configuration must be valid.
+func newGokachu[K comparable, V any](cfg Config, o options[K, V]) *Gokachu[K, V] {
+	store := make(map[K]*valueWithTTL[K, V])
+
 	g := &Gokachu[K, V]{
-		elems:               list.New(),
-		store:               make(map[K]*list.Element),
-		mut:                 new(sync.RWMutex),
-		maxRecordThreshold:  cfg.MaxRecordThreshold,
-		clearNum:            cfg.ClearNum,
-		replacementStrategy: cfg.ReplacementStrategy,
-		pollInterval:        cmp.Or(cfg.PollInterval, time.Second), // Default poll interval is 1 second
-		pollCancel:          make(chan struct{}),
-		wg:                  new(sync.WaitGroup),
+		policy:             newPolicy(cfg.ReplacementStrategy, cfg.MaxRecordThreshold, store),
+		evictable:          cfg.ReplacementStrategy > ReplacementStrategyNone,
+		store:              store,
+		mut:                new(sync.RWMutex),
+		maxRecordThreshold: cfg.MaxRecordThreshold,
+		clearNum:           cfg.ClearNum,
+		lowWatermark:       cfg.LowWatermarkPercent,
+		maxCost:            cfg.MaxCost,
+		weigher:            o.weigher,
+		maxMemory:          cfg.MaxMemoryBytes,
+		sizer:              newSizer[K, V](),
+		silentCapacity:     cfg.SilentCapacityEviction,
+		silentFlush:        cfg.SilentFlush,
+		silentClose:        cfg.SilentClose,
+		pollInterval:       cmp.Or(cfg.PollInterval, time.Second), // Default poll interval is 1 second
+		pollCancel:         make(chan struct{}),
+		wg:                 new(sync.WaitGroup),
+		loader:             o.loader,
+		loadMut:            new(sync.Mutex),
+		loads:              make(map[K]*loadCall[V]),
+		persister:          newPersister[K, V](cfg, o.persistCodec),
 
 		// Hooks
 		onSetHooks:    make(map[uint64]func(key K, value V, ttl time.Duration)),
 		onGetHooks:    make(map[uint64]func(key K, value V)),
 		onMissHooks:   make(map[uint64]func(key K)),
 		onDeleteHooks: make(map[uint64]func(key K, value V)),
+		onEvictHooks:  make(map[uint64]func(key K, value V, reason EvictionReason)),
 	}
 
-	g.wg.Add(1)
+	if o.evictionPolicy != nil {
+		g.policy = o.evictionPolicy()
+		g.evictable = true
+	}
 
-	go g.poll()
+	if _, ok := g.policy.(concurrentAccessPolicy); !ok {
+		g.accesses = newAccessBuffer[K]()
+	}
 
 	return g
 }
@@ -66,56 +304,88 @@ func New[K comparable, V any](cfg Config) *Gokachu[K, V] {
 func (g *Gokachu[K, V]) Set(key K, v V, ttl time.Duration, hooks ...Hook) {
 	defer g.lock()()
 
+	g.set(key, v, ttl, g.weigh(key, v), hooks)
+}
+
+// SetWithCost sets a value in the cache with a TTL and a cost, which overrides the weigher of WithWeigher for this value.
+// If the TTL is 0, the value will not expire.
+func (g *Gokachu[K, V]) SetWithCost(key K, v V, ttl time.Duration, cost int64, hooks ...Hook) {
+	defer g.lock()()
+
+	g.set(key, v, ttl, max(cost, 0), hooks)
+}
+
+// set sets a value with the given cost. The write lock must be held.
+func (g *Gokachu[K, V]) set(key K, v V, ttl time.Duration, cost int64, hooks []Hook) {
 	if g.pollCancel == nil {
 		return
 	}
 
 	g.runOnSetHooks(key, v, ttl)
+	g.applyAccesses()
 
-	exp := time.Time{}
-	if ttl > 0 {
-		exp = time.Now().Add(ttl)
+	protected := func(k K) bool { return k == key }
+	size := g.sizer(key, v)
+	_, exists := g.store[key]
+
+	// clear if the new value does not fit
+	if !exists {
+		g.makeRoom(protected, 1, cost, size)
 	}
 
+	g.put(key, v, expireTime(ttl), ttl, cost, size, hooks)
+
+	// clear if the new cost or size of the existing value does not fit
+	if exists {
+		g.makeRoom(protected, 0, 0, 0)
+	}
+}
+
+// put sets a value with the given expiry, cost and size without evicting anything. The write lock must be held.
+func (g *Gokachu[K, V]) put(key K, v V, exp time.Time, ttl time.Duration, cost, size int64, hooks []Hook) {
 	// if exists
-	if oldElem, ok := g.store[key]; ok {
-		oldElem.Value.(*valueWithTTL[K, V]).value = v
-		oldElem.Value.(*valueWithTTL[K, V]).expireTime = exp
+	if oldValue, ok := g.store[key]; ok {
+		g.runOnEvictHooks(key, oldValue.value, EvictionReasonReplaced)
+
+		oldValue.value = v
+		oldValue.expireTime = exp
+		oldValue.ttl = max(ttl, 0)
+		g.expirations.update(oldValue)
+
+		g.cost += cost - oldValue.cost
+		g.memory += size - oldValue.size
+		oldValue.cost = cost
+		oldValue.size = size
 
 		// set individual hooks
 		for _, hook := range hooks {
 			if hook.OnGet != nil {
-				oldElem.Value.(*valueWithTTL[K, V]).hook.OnGet = hook.OnGet
+				oldValue.hook.OnGet = hook.OnGet
 			}
 
 			if hook.OnDelete != nil {
-				oldElem.Value.(*valueWithTTL[K, V]).hook.OnDelete = hook.OnDelete
+				oldValue.hook.OnDelete = hook.OnDelete
 			}
 		}
 
-		switch g.replacementStrategy {
-		case ReplacementStrategyLRU:
-			g.elems.MoveToBack(oldElem)
-		case ReplacementStrategyMRU:
-			g.elems.MoveToFront(oldElem)
-		}
+		g.policy.OnUpdate(key)
 
 		return
 	}
 
 	// if not exists
-
-	// clear if cache is full
-	if g.maxRecordThreshold > 0 && g.clearNum > 0 && g.replacementStrategy > ReplacementStrategyNone && len(g.store) >= g.maxRecordThreshold {
-		g.clear()
-	}
-
 	value := &valueWithTTL[K, V]{
 		key:        key,
 		value:      v,
+		cost:       cost,
+		size:       size,
 		expireTime: exp,
+		ttl:        max(ttl, 0),
+		heapIndex:  -1,
 	}
 
+	g.expirations.update(value)
+
 	// set individual hooks
 	for _, hook := range hooks {
 		if hook.OnGet != nil {
@@ -127,35 +397,64 @@ func (g *Gokachu[K, V]) Set(key K, v V, ttl time.Duration, hooks ...Hook) {
 		}
 	}
 
-	switch g.replacementStrategy {
-	case ReplacementStrategyFIFO, ReplacementStrategyLRU, ReplacementStrategyLFU, ReplacementStrategyMFU, ReplacementStrategyNone:
-		g.store[key] = g.elems.PushBack(value)
-	case ReplacementStrategyLIFO, ReplacementStrategyMRU:
-		g.store[key] = g.elems.PushFront(value)
-	}
+	g.store[key] = value
+	g.cost += cost
+	g.memory += size
+	g.policy.OnInsert(key)
 }
 
-// Get gets a value from the cache. Returns false in second value if the key does not exist.
+// Get gets a value from the cache. Returns false in second value if the key does not exist or is expired.
+//
+// Get only takes the read lock, so it runs concurrently with other reads and the OnGet hooks may run concurrently too.
+// The access is recorded for the replacement strategy and applied with the next write, see accessBuffer.
 func (g *Gokachu[K, V]) Get(key K) (V, bool) {
-	defer g.lock()()
+	value, result := g.get(key)
+
+	switch result {
+	case getExpired:
+		// delete expired value immediately instead of waiting for the next poll
+		g.deleteIfExpired(key)
+		g.runOnMissHooks(key)
+	case getHitDrain:
+		g.drainAccesses()
+	}
+
+	return value, result == getHit || result == getHitDrain
+}
+
+// getResult tells Get what to do after releasing the read lock.
+type getResult uint8
+
+const (
+	getMiss     getResult = iota
+	getExpired            // the value must be deleted under the write lock
+	getHit                //
+	getHitDrain           // the access buffer asks for a drain
+)
+
+// get looks the key up under the read lock and runs the OnGet or OnMiss hooks, except for expired values.
+func (g *Gokachu[K, V]) get(key K) (V, getResult) {
+	g.mut.RLock()
+	defer g.mut.RUnlock()
+
+	value, ok := g.store[key]
+	if ok && value.expired(time.Now()) {
+		return *new(V), getExpired
+	}
 
-	item, ok := g.store[key]
 	if !ok {
 		g.runOnMissHooks(key)
-		return *new(V), false
+		return *new(V), getMiss
 	}
 
-	value := item.Value.(*valueWithTTL[K, V])
+	value.hitCount.Add(1)
 
-	switch g.replacementStrategy {
-	case ReplacementStrategyLRU:
-		g.elems.MoveToBack(item)
-	case ReplacementStrategyMRU:
-		g.elems.MoveToFront(item)
-	case ReplacementStrategyMFU, ReplacementStrategyLFU:
-		value.hitCount++
+	result := getHit
 
-		g.moveByHits(item)
+	if g.accesses == nil {
+		g.policy.OnAccess(key)
+	} else if g.accesses.record(key) {
+		result = getHitDrain
 	}
 
 	// run hooks before getting value
@@ -165,7 +464,30 @@ func (g *Gokachu[K, V]) Get(key K) (V, bool) {
 		value.hook.OnGet()
 	}
 
-	return value.value, true
+	return value.value, result
+}
+
+// Peek gets a value from the cache like Get, but without any side effect: the replacement strategy does not see the access,
+// the hit count does not change and no hooks run. Returns false in second value if the key does not exist or is expired.
+func (g *Gokachu[K, V]) Peek(key K) (V, bool) {
+	item, ok := g.PeekEntry(key)
+
+	return item.Value, ok
+}
+
+// PeekEntry gets a snapshot of a value with its expiry time, remaining TTL and hit count. Like Peek, it has no side effect.
+// Returns false in second value if the key does not exist or is expired.
+func (g *Gokachu[K, V]) PeekEntry(key K) (Item[K, V], bool) {
+	defer g.rlock()()
+
+	now := time.Now()
+
+	value, ok := g.store[key]
+	if !ok || value.expired(now) {
+		return Item[K, V]{}, false
+	}
+
+	return value.item(now), true
 }
 
 // GetFunc retrieves a first matching value from the cache using a callback function. If all matches return false, the second value also returns false.
@@ -175,9 +497,14 @@ func (g *Gokachu[K, V]) GetFunc(cb func(key K, value V) bool) (V, bool) {
 	var foundKey K
 
 	found := false
+	now := time.Now()
 
 	for k, v := range g.store {
-		if cb(k, v.Value.(*valueWithTTL[K, V]).value) {
+		if v.expired(now) {
+			continue
+		}
+
+		if cb(k, v.value) {
 			foundKey = k
 			found = true
 
@@ -202,16 +529,7 @@ func (g *Gokachu[K, V]) Delete(key K) bool {
 
 	value, ok := g.store[key]
 	if ok {
-		// run hooks before delete
-		g.runOnDeleteHooks(key, value.Value.(*valueWithTTL[K, V]).value)
-
-		if value.Value.(*valueWithTTL[K, V]).hook.OnDelete != nil {
-			value.Value.(*valueWithTTL[K, V]).hook.OnDelete()
-		}
-
-		// delete
-		g.elems.Remove(value)
-		delete(g.store, key)
+		g.remove(value, EvictionReasonDeleted)
 	}
 
 	return ok
@@ -224,17 +542,8 @@ func (g *Gokachu[K, V]) DeleteFunc(cb func(key K, value V) bool) int {
 	count := 0 // deleted count
 
 	for key, value := range g.store {
-		if cb(key, value.Value.(*valueWithTTL[K, V]).value) {
-			// run hooks before delete
-			g.runOnDeleteHooks(key, value.Value.(*valueWithTTL[K, V]).value)
-
-			if value.Value.(*valueWithTTL[K, V]).hook.OnDelete != nil {
-				value.Value.(*valueWithTTL[K, V]).hook.OnDelete()
-			}
-
-			// delete
-			g.elems.Remove(value)
-			delete(g.store, key)
+		if cb(key, value.value) {
+			g.remove(value, EvictionReasonDeletedFunc)
 
 			count++
 		}
@@ -243,50 +552,143 @@ func (g *Gokachu[K, V]) DeleteFunc(cb func(key K, value V) bool) int {
 	return count
 }
 
-// Flush deletes all values from the cache and return the number of deleted values.
+// Flush deletes all values from the cache and return the number of deleted values. Delete hooks run for each value unless Config.SilentFlush is set.
 func (g *Gokachu[K, V]) Flush() int {
 	defer g.lock()()
 
-	g.elems.Init()
 	count := len(g.store)
-	clear(g.store)
+	g.removeAll(EvictionReasonFlushed)
 
 	return count
 }
 
-// Keys returns all keys in the cache.
+// Keys returns all keys in the cache in eviction order, the next victim first. Expired keys are skipped.
 func (g *Gokachu[K, V]) Keys() []K {
+	g.syncAccesses()
 	defer g.rlock()()
 
 	keys := make([]K, 0, len(g.store))
+	now := time.Now()
 
-	for e := g.elems.Front(); e != nil; e = e.Next() {
-		keys = append(keys, e.Value.(*valueWithTTL[K, V]).key)
+	for key := range g.policy.Keys() {
+		if g.store[key].expired(now) {
+			continue
+		}
+
+		keys = append(keys, key)
 	}
 
-	return keys
+	return slices.Clip(keys)
 }
 
 // KeysFunc returns all keys in the cache for which the callback returns true.
 func (g *Gokachu[K, V]) KeysFunc(cb func(key K, value V) bool) []K {
+	g.syncAccesses()
 	defer g.rlock()()
 
 	keys := make([]K, 0, len(g.store))
+	now := time.Now()
 
-	for e := g.elems.Front(); e != nil; e = e.Next() {
-		if cb(e.Value.(*valueWithTTL[K, V]).key, e.Value.(*valueWithTTL[K, V]).value) {
-			keys = append(keys, e.Value.(*valueWithTTL[K, V]).key)
+	for key := range g.policy.Keys() {
+		value := g.store[key]
+		if value.expired(now) {
+			continue
+		}
+
+		if cb(key, value.value) {
+			keys = append(keys, key)
 		}
 	}
 
 	return slices.Clip(keys)
 }
 
-// Count returns the number of values in the cache.
+// All returns an iterator over the keys and values in the cache in eviction order, the next victim first. Expired values are skipped.
+//
+// The read lock is held until the loop ends, so the loop body must not call methods of the cache; doing so may deadlock.
+// Use Items for a snapshot that can be processed freely.
+func (g *Gokachu[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		g.syncAccesses()
+		defer g.rlock()()
+
+		now := time.Now()
+
+		for key := range g.policy.Keys() {
+			value := g.store[key]
+			if value.expired(now) {
+				continue
+			}
+
+			if !yield(key, value.value) {
+				return
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over the keys in the cache in eviction order. See All for the locking rules.
+func (g *Gokachu[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range g.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over the values in the cache in eviction order. See All for the locking rules.
+func (g *Gokachu[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range g.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Items returns a snapshot of the values in the cache in eviction order. Expired values are skipped.
+func (g *Gokachu[K, V]) Items() []Item[K, V] {
+	g.syncAccesses()
+	defer g.rlock()()
+
+	items := make([]Item[K, V], 0, len(g.store))
+	now := time.Now()
+
+	for key := range g.policy.Keys() {
+		value := g.store[key]
+		if value.expired(now) {
+			continue
+		}
+
+		items = append(items, value.item(now))
+	}
+
+	return slices.Clip(items)
+}
+
+// Count returns the number of values in the cache. Expired values are not counted.
 func (g *Gokachu[K, V]) Count() int {
 	defer g.rlock()()
 
-	return g.elems.Len()
+	now := time.Now()
+
+	// fast path: nothing is waiting for the next poll
+	if !g.expirations.hasExpired(now) {
+		return len(g.store)
+	}
+
+	count := 0
+
+	for _, value := range g.store {
+		if !value.expired(now) {
+			count++
+		}
+	}
+
+	return count
 }
 
 // CountFunc returns the number of values in the cache for which the callback returns true.
@@ -294,9 +696,14 @@ func (g *Gokachu[K, V]) CountFunc(cb func(key K, value V) bool) int {
 	defer g.rlock()()
 
 	count := 0
+	now := time.Now()
 
 	for key, value := range g.store {
-		if cb(key, value.Value.(*valueWithTTL[K, V]).value) {
+		if value.expired(now) {
+			continue
+		}
+
+		if cb(key, value.value) {
 			count++
 		}
 	}
@@ -304,7 +711,26 @@ func (g *Gokachu[K, V]) CountFunc(cb func(key K, value V) bool) int {
 	return count
 }
 
-// Close closes the cache and all associated resources.
+// Cost returns the total cost of the values in the cache. See Config.MaxCost.
+func (g *Gokachu[K, V]) Cost() int64 {
+	defer g.rlock()()
+
+	return g.cost
+}
+
+// MemoryBytes returns the approximate heap footprint of the cache. See Config.MaxMemoryBytes.
+//
+// Values implementing Sizer report their own size. Otherwise strings and byte slices count their contents and other
+// types count their fixed size only, so memory referenced by pointers, maps and other slices is not included.
+// Every entry also counts a fixed overhead for the bookkeeping of the cache.
+func (g *Gokachu[K, V]) MemoryBytes() int64 {
+	defer g.rlock()()
+
+	return g.memory
+}
+
+// Close closes the cache and all associated resources. Delete hooks run for each remaining value unless Config.SilentClose is set.
+// If Config.PersistPath is set, the cache is saved before its values are deleted.
 func (g *Gokachu[K, V]) Close() {
 	g.mut.Lock()
 
@@ -313,19 +739,100 @@ func (g *Gokachu[K, V]) Close() {
 		return
 	}
 
+	var records []snapshotRecord[K, V]
+	if g.persister.enabled() {
+		g.applyAccesses()
+		records = g.collectRecords()
+	}
+
 	close(g.pollCancel)
-	clear(g.store)
+	g.pollCancel = nil
+	g.removeAll(EvictionReasonClosed)
 
 	// clear hooks
 	g.onSetHooks = nil
 	g.onGetHooks = nil
 	g.onDeleteHooks = nil
 	g.onMissHooks = nil
+	g.onEvictHooks = nil
 
-	g.elems.Init()
 	g.mut.Unlock()
 
 	g.wg.Wait()
+
+	// saved after the periodic saves stopped, so the last state wins
+	if g.persister.enabled() {
+		g.persister.save(records)
+	}
+}
+
+// remove runs the delete and evict hooks of a value, then removes it from the policy, the store and the expiration heap. The write lock must be held.
+func (g *Gokachu[K, V]) remove(value *valueWithTTL[K, V], reason EvictionReason) {
+	g.runRemoveHooks(value, reason)
+
+	g.policy.OnRemove(value.key)
+	g.expirations.remove(value)
+	delete(g.store, value.key)
+
+	g.cost -= value.cost
+	g.memory -= value.size
+}
+
+// removeAll runs the delete and evict hooks of all values in eviction order, then empties the cache. The write lock must be held.
+func (g *Gokachu[K, V]) removeAll(reason EvictionReason) {
+	g.applyAccesses()
+
+	for _, key := range slices.Collect(g.policy.Keys()) {
+		g.runRemoveHooks(g.store[key], reason)
+		g.policy.OnRemove(key)
+	}
+
+	clear(g.store)
+	g.expirations = nil
+	g.cost = 0
+	g.memory = 0
+}
+
+// weigh returns the cost of a value using the weigher of WithWeigher. Values cost 1 without a weigher.
+func (g *Gokachu[K, V]) weigh(key K, v V) int64 {
+	if g.weigher == nil {
+		return 1
+	}
+
+	return max(g.weigher(key, v), 0)
+}
+
+// drainAccesses applies the recorded accesses of Get to the eviction policy if the write lock is free.
+// Otherwise they are applied by a later write.
+func (g *Gokachu[K, V]) drainAccesses() {
+	if g.mut.TryLock() {
+		g.applyAccesses()
+		g.mut.Unlock()
+	}
+}
+
+// syncAccesses applies the recorded accesses of Get to the eviction policy, so the order of the policy is up to date.
+func (g *Gokachu[K, V]) syncAccesses() {
+	if g.accesses != nil && g.accesses.pending() {
+		defer g.lock()()
+
+		g.applyAccesses()
+	}
+}
+
+// applyAccesses applies the recorded accesses of Get to the eviction policy. The write lock must be held.
+// Writes depending on the order of the policy call it first.
+func (g *Gokachu[K, V]) applyAccesses() {
+	if g.accesses == nil || !g.accesses.pending() {
+		return
+	}
+
+	g.accesses.drain(func(key K) {
+		// the key may have been deleted after it was read
+		if _, ok := g.store[key]; ok {
+			g.policy.OnAccess(key)
+		}
+	})
 }
 
 func (k *Gokachu[K, V]) lock() func() {
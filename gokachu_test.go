@@ -1,10 +1,20 @@
 package gokachu
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -62,6 +72,50 @@ func BenchmarkGokachu_InsertEvict(b *testing.B) {
 	}
 }
 
+func BenchmarkGokachu_GetLFU(b *testing.B) {
+	const capacity = 100_000
+
+	k := New[int, int](Config{
+		ReplacementStrategy: ReplacementStrategyLFU,
+		MaxRecordThreshold:  capacity,
+		ClearNum:            1,
+	})
+	defer k.Close()
+
+	// every key shares the same hit count
+	for i := range capacity {
+		k.Set(i, i, 0)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; b.Loop(); i++ {
+		k.Get(i % capacity)
+	}
+}
+
+func BenchmarkGokachu_GetParallel(b *testing.B) {
+	const capacity = 1000
+
+	k := New[int, int](Config{
+		ReplacementStrategy: ReplacementStrategyLRU,
+		MaxRecordThreshold:  capacity,
+	})
+	defer k.Close()
+
+	for i := range capacity {
+		k.Set(i, i, 0)
+	}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			k.Get(i % capacity)
+		}
+	})
+}
+
 func TestGokachuReplacementStrategies(t *testing.T) {
 	t.Run("when reaches max record threshold, then clean", func(t *testing.T) {
 		k := New[string, string](Config{
@@ -203,8 +257,9 @@ func TestGokachuReplacementStrategies(t *testing.T) {
 			t.Errorf("expected count to be 5, but got %d", k.Count())
 		}
 
-		if !reflect.DeepEqual(k.Keys(), []string{"3", "2", "1", "0", "10"}) {
-			t.Errorf("expected keys to be [3 2 1 0 10], but got %v", k.Keys())
+		// "10" has no hits yet, so it is the least frequently used key
+		if !reflect.DeepEqual(k.Keys(), []string{"10", "3", "2", "1", "0"}) {
+			t.Errorf("expected keys to be [10 3 2 1 0], but got %v", k.Keys())
 		}
 	})
 
@@ -243,6 +298,376 @@ func TestGokachuReplacementStrategies(t *testing.T) {
 			t.Errorf("expected keys to be [10 6 7 8 9], but got %v", k.Keys())
 		}
 	})
+
+	t.Run("when scans, then keep popular keys by TinyLFU", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategyTinyLFU,
+			MaxRecordThreshold:  10,
+			ClearNum:            1,
+		})
+		defer k.Close()
+
+		popular := []string{"p0", "p1", "p2", "p3", "p4"}
+
+		for _, key := range popular {
+			k.Set(key, "value", 0)
+		}
+
+		for range 5 {
+			for _, key := range popular {
+				k.Get(key)
+			}
+		}
+
+		// one-off keys of a scan
+		for i := 0; i < 100; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		if k.Count() != 10 {
+			t.Errorf("expected count to be 10, but got %d", k.Count())
+		}
+
+		for _, key := range popular {
+			if _, ok := k.Get(key); !ok {
+				t.Errorf("expected popular key %s to survive the scan", key)
+			}
+		}
+	})
+
+	t.Run("when cleans, then check sort of keys by ARC", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategyARC,
+			MaxRecordThreshold:  10,
+			ClearNum:            6,
+		})
+		defer k.Close()
+
+		for i := 0; i < 10; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		// seen twice, moves to T2
+		for i := 0; i < 5; i++ {
+			k.Get(fmt.Sprint(i))
+		}
+
+		k.Set("10", "value", 0) // evicts 5, 6, 7, 8, 9 from T1, then 0 from T2
+
+		if !reflect.DeepEqual(k.Keys(), []string{"10", "1", "2", "3", "4"}) {
+			t.Errorf("expected keys to be [10 1 2 3 4], but got %v", k.Keys())
+		}
+
+		k.Set("5", "value", 0) // ghost hit in B1, grows T1 and goes to T2
+
+		if !reflect.DeepEqual(k.Keys(), []string{"10", "1", "2", "3", "4", "5"}) {
+			t.Errorf("expected keys to be [10 1 2 3 4 5], but got %v", k.Keys())
+		}
+
+		if target := k.policy.(*arcPolicy[string]).target; target != 1 {
+			t.Errorf("expected target size of T1 to be 1, but got %d", target)
+		}
+	})
+
+	t.Run("when the ARC victim is protected, then the evicted key becomes a ghost", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategyARC,
+			MaxRecordThreshold:  3,
+		})
+		defer k.Close()
+
+		for _, key := range []string{"a", "b", "c"} {
+			k.Set(key, "value", 0)
+		}
+
+		k.SetMany(map[string]string{"a": "value", "x": "value"}, 0) // a is the victim but part of the batch, evicts b
+
+		p := k.policy.(*arcPolicy[string])
+
+		if b1 := p.lists[arcB1]; b1.Len() != 1 || b1.Front().Value != "b" {
+			t.Errorf("expected b to be the only ghost in B1, but got %d ghosts", b1.Len())
+		}
+
+		k.Delete("a")
+
+		if _, ok := p.store["a"]; ok {
+			t.Error("expected deleted a to be forgotten, but it is a ghost")
+		}
+	})
+
+	t.Run("when cleans, then check sort of keys by SIEVE", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategySIEVE,
+			MaxRecordThreshold:  10,
+			ClearNum:            6,
+		})
+		defer k.Close()
+
+		for i := 0; i < 10; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		for i := 0; i < 5; i++ {
+			k.Get(fmt.Sprint(i))
+		}
+
+		k.Set("10", "value", 0) // the hand clears 0-4, evicts 5-9, then wraps and evicts 0
+
+		if !reflect.DeepEqual(k.Keys(), []string{"1", "2", "3", "4", "10"}) {
+			t.Errorf("expected keys to be [1 2 3 4 10], but got %v", k.Keys())
+		}
+	})
+
+	t.Run("when cleans, then check sort of keys by S3FIFO", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategyS3FIFO,
+			MaxRecordThreshold:  10,
+			ClearNum:            6,
+		})
+		defer k.Close()
+
+		for i := 0; i < 10; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		for range 2 {
+			for i := 0; i < 5; i++ {
+				k.Get(fmt.Sprint(i))
+			}
+		}
+
+		k.Set("10", "value", 0) // promotes 0-4 to main, evicts 5-9 to ghost, then evicts 0 from main
+
+		if !reflect.DeepEqual(k.Keys(), []string{"10", "1", "2", "3", "4"}) {
+			t.Errorf("expected keys to be [10 1 2 3 4], but got %v", k.Keys())
+		}
+
+		k.Set("5", "value", 0) // ghost hit, goes to main
+
+		if !reflect.DeepEqual(k.Keys(), []string{"10", "1", "2", "3", "4", "5"}) {
+			t.Errorf("expected keys to be [10 1 2 3 4 5], but got %v", k.Keys())
+		}
+	})
+
+	t.Run("when cleans, then check sort of keys by CLOCK", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategyCLOCK,
+			MaxRecordThreshold:  10,
+			ClearNum:            6,
+		})
+		defer k.Close()
+
+		for i := 0; i < 10; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		for i := 0; i < 10; i++ {
+			k.Get(fmt.Sprint(9 - i))
+		}
+
+		k.Set("10", "value", 0) // every key has a second chance, so the hand goes around once and evicts 0-5
+
+		if !reflect.DeepEqual(k.Keys(), []string{"6", "7", "8", "9", "10"}) {
+			t.Errorf("expected keys to be [6 7 8 9 10], but got %v", k.Keys())
+		}
+
+		k.Get("6")
+
+		// new keys enter behind the hand
+		for i := 11; i < 16; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		k.Set("16", "value", 0) // gives 6 a second chance, evicts 7-12
+
+		if !reflect.DeepEqual(k.Keys(), []string{"13", "14", "15", "6", "16"}) {
+			t.Errorf("expected keys to be [13 14 15 6 16], but got %v", k.Keys())
+		}
+	})
+
+	t.Run("when cleans, then check sort of keys by 2Q", func(t *testing.T) {
+		k := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategy2Q,
+			MaxRecordThreshold:  10,
+			ClearNum:            6,
+		})
+		defer k.Close()
+
+		for i := 0; i < 10; i++ {
+			k.Set(fmt.Sprint(i), "value", 0)
+		}
+
+		for i := 0; i < 10; i++ {
+			k.Get(fmt.Sprint(9 - i))
+		}
+
+		k.Set("10", "value", 0) // reads do not move keys in A1in, evicts 0-5 to A1out
+
+		if !reflect.DeepEqual(k.Keys(), []string{"6", "7", "8", "9", "10"}) {
+			t.Errorf("expected keys to be [6 7 8 9 10], but got %v", k.Keys())
+		}
+
+		k.Set("3", "value", 0) // found in A1out, enters Am
+		k.Set("4", "value", 0)
+		k.Get("3")
+
+		if !reflect.DeepEqual(k.Keys(), []string{"6", "7", "8", "9", "10", "4", "3"}) {
+			t.Errorf("expected keys to be [6 7 8 9 10 4 3], but got %v", k.Keys())
+		}
+
+		k.Set("0", "value", 0) // forgotten by A1out, enters A1in
+
+		if !reflect.DeepEqual(k.Keys(), []string{"6", "7", "8", "9", "10", "0", "4", "3"}) {
+			t.Errorf("expected keys to be [6 7 8 9 10 0 4 3], but got %v", k.Keys())
+		}
+	})
+}
+
+func TestFrequencyBuckets(t *testing.T) {
+	p := newFrequencyPolicy[string](false)
+
+	for _, key := range []string{"a", "b", "c"} {
+		p.OnInsert(key)
+	}
+
+	p.OnAccess("a")
+	p.OnAccess("b")
+	p.OnAccess("a")
+	p.OnAccess("c")
+
+	// hits: a=2, b=1, c=1 (b reached 1 hit before c)
+	if keys := slices.Collect(p.Keys()); !reflect.DeepEqual(keys, []string{"b", "c", "a"}) {
+		t.Errorf("expected keys to be [b c a], but got %v", keys)
+	}
+
+	p.OnRemove("b")
+	p.OnRemove("c")
+
+	if p.buckets.Len() != 1 {
+		t.Errorf("expected empty buckets to be dropped, but got %d buckets", p.buckets.Len())
+	}
+
+	p.OnInsert("d")
+
+	if victim, _ := p.Victim(); victim != "d" {
+		t.Errorf("expected victim to be d, but got %s", victim)
+	}
+
+	p.mfu = true
+
+	if victim, _ := p.Victim(); victim != "a" {
+		t.Errorf("expected victim to be a, but got %s", victim)
+	}
+}
+
+func TestCountMinSketch(t *testing.T) {
+	s := newCountMinSketch[string](16)
+
+	for range 8 {
+		s.increment("hot")
+	}
+
+	s.increment("cold")
+
+	if s.estimate("hot") != 8 || s.estimate("cold") != 1 || s.estimate("none") != 0 {
+		t.Errorf("expected estimates to be 8, 1 and 0, but got %d, %d and %d", s.estimate("hot"), s.estimate("cold"), s.estimate("none"))
+	}
+
+	s.age()
+
+	if s.estimate("hot") != 4 || s.estimate("cold") != 0 {
+		t.Errorf("expected aged estimates to be 4 and 0, but got %d and %d", s.estimate("hot"), s.estimate("cold"))
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	for strategy := ReplacementStrategyLRU; strategy <= ReplacementStrategyCLOCK; strategy++ {
+		k := New[int, int](Config{
+			ReplacementStrategy: strategy,
+			MaxRecordThreshold:  100,
+			ClearNum:            10,
+		})
+
+		concurrent := strategy == ReplacementStrategySIEVE || strategy == ReplacementStrategyS3FIFO || strategy == ReplacementStrategyCLOCK
+		if concurrent != (k.accesses == nil) {
+			t.Errorf("expected strategy %d to record accesses in a buffer: %t", strategy, !concurrent)
+		}
+
+		var wg sync.WaitGroup
+
+		for i := range 8 {
+			wg.Go(func() {
+				for j := range 1000 {
+					if i == 0 {
+						k.Set(j%200, j, 0)
+						continue
+					}
+
+					k.Get(j % 200)
+				}
+			})
+		}
+
+		wg.Wait()
+
+		if k.Count() > 100 {
+			t.Errorf("expected count to be at most 100, but got %d", k.Count())
+		}
+
+		k.Close()
+	}
+}
+
+func TestAccessBuffer(t *testing.T) {
+	b := newAccessBuffer[int]()
+	b.stripes, b.mask = b.stripes[:1], 0 // a single stripe keeps the order
+
+	for i := range accessStripeSize - 1 {
+		if b.record(i) {
+			t.Fatalf("expected stripe not to be full after %d accesses", i+1)
+		}
+	}
+
+	if !b.record(accessStripeSize-1) || !b.record(accessStripeSize) {
+		t.Error("expected full stripe to ask for a drain")
+	}
+
+	b.stripes[0].mut.Lock()
+	b.record(-1) // busy stripe, dropped
+	b.stripes[0].mut.Unlock()
+
+	drained := []int{}
+	b.drain(func(key int) { drained = append(drained, key) })
+
+	if len(drained) != accessStripeSize || drained[0] != 0 || drained[accessStripeSize-1] != accessStripeSize-1 {
+		t.Errorf("expected accesses 0..%d in order, but got %v", accessStripeSize-1, drained)
+	}
+
+	if b.pending() {
+		t.Error("expected buffer to be empty after drain")
+	}
+
+	// accesses recorded under the read lock decide the next victim
+	g := New[int, int](Config{
+		ReplacementStrategy: ReplacementStrategyLRU,
+		MaxRecordThreshold:  3,
+	})
+	defer g.Close()
+
+	g.Set(1, 1, 0)
+	g.Set(2, 2, 0)
+	g.Set(3, 3, 0)
+	g.Get(1)
+
+	if !g.accesses.pending() {
+		t.Error("expected access to wait in the buffer")
+	}
+
+	g.Set(4, 4, 0) // evicts 2
+
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []int{3, 1, 4}) {
+		t.Errorf("expected keys to be [3 1 4], but got %v", keys)
+	}
 }
 
 func TestSet(t *testing.T) {
@@ -444,16 +869,102 @@ func TestTTL(t *testing.T) {
 	})
 }
 
-func TestClose(t *testing.T) {
-	t.Run("check goroutine is closed", func(t *testing.T) {
-		start := runtime.NumGoroutine()
-
-		k := New[string, string](Config{})
-		k.Close()
-
-		if start != runtime.NumGoroutine() {
-			t.Errorf("expected %d, but got %d", start, runtime.NumGoroutine())
-		}
+func TestExpire(t *testing.T) {
+	g := New[int, int](Config{
+		PollInterval: time.Hour, // expire is called manually
+	})
+	defer g.Close()
+
+	const n = 3*expireBatchSize + 10
+
+	for i := range n {
+		g.Set(i, i, time.Millisecond)
+	}
+
+	g.Set(n, n, 0)
+	g.Set(n+1, n+1, time.Hour)
+	g.Set(0, 0, time.Hour) // overrides the TTL of an expiring value
+
+	time.Sleep(10 * time.Millisecond)
+	g.expire()
+
+	if !reflect.DeepEqual(g.Keys(), []int{0, n, n + 1}) {
+		t.Errorf("expected keys to be [0 %d %d], but got %v", n, n+1, g.Keys())
+	}
+
+	if g.expirations.Len() != 2 {
+		t.Errorf("expected 2 values in expiration heap, but got %d", g.expirations.Len())
+	}
+
+	g.Set(n+1, n+1, 0) // removes the TTL
+
+	if g.expirations.Len() != 1 {
+		t.Errorf("expected 1 value in expiration heap, but got %d", g.expirations.Len())
+	}
+}
+
+func TestLazyExpiration(t *testing.T) {
+	g := New[string, string](Config{
+		PollInterval: time.Hour, // never polls during the test
+	})
+	defer g.Close()
+
+	deleted := []string{}
+
+	g.AddOnDeleteHook(func(key, _ string) {
+		deleted = append(deleted, key)
+	})
+
+	g.Set("a1", "a1", 50*time.Millisecond)
+	g.Set("a2", "a2", 0)
+
+	time.Sleep(100 * time.Millisecond)
+
+	all := func(_, _ string) bool { return true }
+
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"a2"}) {
+		t.Errorf("expected keys to be [a2], but got %v", keys)
+	}
+
+	if keys := g.KeysFunc(all); !reflect.DeepEqual(keys, []string{"a2"}) {
+		t.Errorf("expected keys to be [a2], but got %v", keys)
+	}
+
+	if count := g.Count(); count != 1 {
+		t.Errorf("expected count to be 1, but got %d", count)
+	}
+
+	if count := g.CountFunc(all); count != 1 {
+		t.Errorf("expected count to be 1, but got %d", count)
+	}
+
+	if v, _ := g.GetFunc(func(key, _ string) bool { return key == "a1" }); v != "" {
+		t.Errorf("expected expired value to be skipped, but got %s", v)
+	}
+
+	if _, ok := g.Get("a1"); ok {
+		t.Errorf("expected key to be expired")
+	}
+
+	if !reflect.DeepEqual(deleted, []string{"a1"}) {
+		t.Errorf("expected deleted keys to be [a1], but got %v", deleted)
+	}
+
+	if len(g.store) != 1 {
+		t.Errorf("expected store count to be 1, but got %d", len(g.store))
+	}
+}
+
+func TestClose(t *testing.T) {
+	t.Run("check goroutine is closed", func(t *testing.T) {
+		start := runtime.NumGoroutine()
+
+		k := New[string, string](Config{})
+		k.Close()
+
+		if start != runtime.NumGoroutine() {
+			t.Errorf("expected %d, but got %d", start, runtime.NumGoroutine())
+		}
 	})
 
 	t.Run("check if usable after close", func(t *testing.T) {
@@ -501,11 +1012,11 @@ func TestDeleteFunc(t *testing.T) {
 	g.DeleteFunc(func(_, value string) bool {
 		return strings.HasPrefix(value, "b")
 	})
-	if g.elems.Len() != 1 {
-		t.Errorf("expected elems count to be 1, but got %d", g.elems.Len())
+	if policyLen(g) != 1 {
+		t.Errorf("expected policy count to be 1, but got %d", policyLen(g))
 	}
 	if len(g.store) != 1 {
-		t.Errorf("expected store count to be 1, but got %d", g.elems.Len())
+		t.Errorf("expected store count to be 1, but got %d", len(g.store))
 	}
 	g.Close()
 }
@@ -578,21 +1089,1735 @@ func TestCountFunc(t *testing.T) {
 	g.Close()
 }
 
-func TestFlush(t *testing.T) {
-	g := New[string, string](Config{})
-	g.Set("a1", "a1", 0)
-	g.Set("a2", "a2", 0)
-	g.Set("a3", "a3", 0)
-	g.Set("b1", "b1", 0)
-	g.Set("b2", "b2", 0)
-	g.Set("b3", "b3", 0)
-	g.Set("c1", "c1", 0)
-	g.Flush()
-	if g.elems.Len() != 0 {
-		t.Errorf("expected elems count to be 0, but got %d", g.elems.Len())
+func TestIterators(t *testing.T) {
+	g := New[string, int](Config{
+		ReplacementStrategy: ReplacementStrategyLRU,
+		MaxRecordThreshold:  10,
+		PollInterval:        time.Hour, // expire is called manually
+	})
+	defer g.Close()
+
+	g.Set("a", 1, 0)
+	g.Set("b", 2, time.Hour)
+	g.Set("c", 3, 0)
+	g.Set("expired", 4, time.Millisecond)
+	g.Get("a")
+	g.Get("a")
+
+	time.Sleep(5 * time.Millisecond)
+
+	keys, values := []string{}, []int{}
+
+	for key, value := range g.All() {
+		keys = append(keys, key)
+		values = append(values, value)
 	}
-	if len(g.store) != 0 {
-		t.Errorf("expected store count to be 0, but got %d", g.elems.Len())
+
+	if !reflect.DeepEqual(keys, []string{"b", "c", "a"}) || !reflect.DeepEqual(values, []int{2, 3, 1}) {
+		t.Errorf("expected [b c a] and [2 3 1], but got %v and %v", keys, values)
+	}
+
+	if keys := slices.Collect(g.KeysSeq()); !reflect.DeepEqual(keys, []string{"b", "c", "a"}) {
+		t.Errorf("expected keys to be [b c a], but got %v", keys)
+	}
+
+	if values := slices.Collect(g.Values()); !reflect.DeepEqual(values, []int{2, 3, 1}) {
+		t.Errorf("expected values to be [2 3 1], but got %v", values)
+	}
+
+	for range g.All() {
+		break // releases the read lock
+	}
+
+	g.Set("d", 5, 0)
+
+	items := g.Items()
+	if len(items) != 4 {
+		t.Fatalf("expected 4 items, but got %v", items)
+	}
+
+	if items[2].Key != "a" || items[2].Value != 1 || items[2].HitCount != 2 || !items[2].ExpireTime.IsZero() {
+		t.Errorf("expected item a with 2 hits and no expiry, but got %+v", items[2])
+	}
+
+	if items[0].Key != "b" || items[0].HitCount != 0 || time.Until(items[0].ExpireTime) <= 0 {
+		t.Errorf("expected item b to expire in the future, but got %+v", items[0])
+	}
+
+	s := NewSharded[int, int](Config{}, 4)
+	defer s.Close()
+
+	for i := range 10 {
+		s.Set(i, i*10, 0)
+	}
+
+	sum := 0
+
+	for key, value := range s.All() {
+		if value != key*10 {
+			t.Errorf("expected value of %d to be %d, but got %d", key, key*10, value)
+		}
+
+		sum += key
+	}
+
+	if sum != 45 || len(s.Items()) != 10 || len(slices.Collect(s.KeysSeq())) != 10 || len(slices.Collect(s.Values())) != 10 {
+		t.Errorf("expected iterators of a sharded cache to visit every key once")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	g := New[string, string](Config{
+		ReplacementStrategy: ReplacementStrategyLRU,
+		MaxRecordThreshold:  3,
+	})
+	defer g.Close()
+
+	hooks := 0
+
+	g.AddOnGetHook(func(string, string) { hooks++ })
+	g.AddOnMissHook(func(string) { hooks++ })
+
+	g.Set("a", "1", time.Hour, WithOnGetHook(func() { hooks++ }))
+	g.Set("b", "2", 0)
+	g.Set("expired", "3", time.Nanosecond)
+
+	if value, ok := g.Peek("a"); !ok || value != "1" {
+		t.Errorf("expected value to be 1, but got %s", value)
+	}
+
+	if _, ok := g.Peek("expired"); ok {
+		t.Error("expected expired value to be missing")
+	}
+
+	if _, ok := g.Peek("missing"); ok {
+		t.Error("expected missing value to be missing")
+	}
+
+	item, ok := g.PeekEntry("a")
+	if !ok || item.Key != "a" || item.Value != "1" || item.HitCount != 0 {
+		t.Errorf("expected entry a with no hits, but got %+v", item)
+	}
+
+	if item.TTL <= 0 || item.TTL > time.Hour || item.ExpireTime.IsZero() {
+		t.Errorf("expected entry a to expire within an hour, but got %+v", item)
+	}
+
+	if item, _ := g.PeekEntry("b"); item.TTL != 0 || !item.ExpireTime.IsZero() {
+		t.Errorf("expected entry b not to expire, but got %+v", item)
+	}
+
+	if hooks != 0 {
+		t.Errorf("expected no hooks to run, but %d ran", hooks)
+	}
+
+	g.Set("c", "4", 0) // evicts "a", since peeking did not make it recent
+
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"b", "c"}) {
+		t.Errorf("expected keys to be [b c], but got %v", keys)
+	}
+}
+
+func TestTTLControl(t *testing.T) {
+	g := New[string, string](Config{
+		ReplacementStrategy: ReplacementStrategyMRU,
+		MaxRecordThreshold:  10,
+		PollInterval:        time.Hour, // expire is called manually
+	})
+	defer g.Close()
+
+	sets := 0
+
+	g.AddOnSetHook(func(string, string, time.Duration) { sets++ })
+
+	g.Set("a", "1", 0)
+	g.Set("b", "2", time.Hour)
+	g.Set("c", "3", 0)
+
+	if ttl, ok := g.TTL("a"); !ok || ttl != 0 {
+		t.Errorf("expected a not to expire, but got %v %t", ttl, ok)
+	}
+
+	if ttl, ok := g.TTL("b"); !ok || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("expected b to expire in an hour, but got %v", ttl)
+	}
+
+	if _, ok := g.TTL("missing"); ok {
+		t.Error("expected missing key to have no TTL")
+	}
+
+	if !g.Expire("a", 20*time.Millisecond) || g.Expire("missing", time.Second) {
+		t.Error("expected Expire to report whether the key exists")
+	}
+
+	if !g.ExpireAt("c", time.Now().Add(time.Hour)) {
+		t.Error("expected ExpireAt to succeed")
+	}
+
+	if ttl, _ := g.TTL("c"); ttl <= 59*time.Minute {
+		t.Errorf("expected c to expire in an hour, but got %v", ttl)
+	}
+
+	if !g.Persist("b") {
+		t.Error("expected Persist to succeed")
+	}
+
+	if ttl, _ := g.TTL("b"); ttl != 0 {
+		t.Errorf("expected b not to expire after Persist, but got %v", ttl)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if !g.Touch("a") {
+		t.Error("expected Touch to succeed")
+	}
+
+	if ttl, _ := g.TTL("a"); ttl <= 15*time.Millisecond {
+		t.Errorf("expected Touch to restart the TTL of a, but got %v", ttl)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g.expire()
+
+	if _, ok := g.Get("a"); ok {
+		t.Error("expected a to be expired")
+	}
+
+	if g.Touch("a") || g.Persist("a") {
+		t.Error("expected expired key not to be changed")
+	}
+
+	if !g.ExpireAt("c", time.Now().Add(-time.Second)) {
+		t.Error("expected ExpireAt in the past to succeed")
+	}
+
+	if _, ok := g.Get("c"); ok {
+		t.Error("expected c to expire immediately")
+	}
+
+	if sets != 3 {
+		t.Errorf("expected only Set to run OnSet hooks, but got %d calls", sets)
+	}
+
+	if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Errorf("expected keys to be [b], but got %v", keys)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	g := New[string, string](Config{
+		PollInterval: time.Hour, // expire is called manually
+	})
+	defer g.Close()
+
+	sets, deletes := 0, 0
+
+	g.AddOnSetHook(func(string, string, time.Duration) { sets++ })
+	g.AddOnDeleteHook(func(string, string) { deletes++ })
+
+	if !g.SetIfAbsent("a", "1", 0) || g.SetIfAbsent("a", "2", 0) {
+		t.Error("expected only the first SetIfAbsent to set the value")
+	}
+
+	if g.Replace("missing", "1", 0) || !g.Replace("a", "3", time.Hour) {
+		t.Error("expected Replace to set existing values only")
+	}
+
+	if value, _ := g.Get("a"); value != "3" {
+		t.Errorf("expected value to be 3, but got %s", value)
+	}
+
+	exp, _ := g.PeekEntry("a")
+
+	if g.CompareAndSwap("a", "1", "4", nil) || !g.CompareAndSwap("a", "3", "4", nil) {
+		t.Error("expected CompareAndSwap to swap the matching value only")
+	}
+
+	if item, _ := g.PeekEntry("a"); item.Value != "4" || !item.ExpireTime.Equal(exp.ExpireTime) {
+		t.Errorf("expected value 4 with the same expiry, but got %+v", item)
+	}
+
+	caseInsensitive := func(a, b string) bool { return strings.EqualFold(a, b) }
+
+	g.Set("b", "X", 0)
+
+	if g.CompareAndDelete("b", "y", caseInsensitive) || !g.CompareAndDelete("b", "x", caseInsensitive) {
+		t.Error("expected CompareAndDelete to delete the matching value only")
+	}
+
+	g.Set("expired", "1", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if g.Replace("expired", "2", 0) || !g.SetIfAbsent("expired", "3", 0) {
+		t.Error("expected an expired value to be absent")
+	}
+
+	if sets != 6 || deletes != 2 {
+		t.Errorf("expected 6 set and 2 delete hook calls, but got %d and %d", sets, deletes)
+	}
+
+	wins := atomic.Int64{}
+	wg := sync.WaitGroup{}
+
+	for i := range 16 {
+		wg.Go(func() {
+			if g.SetIfAbsent("race", fmt.Sprint(i), 0) {
+				wins.Add(1)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Errorf("expected exactly one writer to win, but got %d", wins.Load())
+	}
+}
+
+func TestCompute(t *testing.T) {
+	g := New[string, int](Config{
+		PollInterval: time.Hour, // expire is called manually
+	})
+	defer g.Close()
+
+	sets, deletes := 0, 0
+
+	g.AddOnSetHook(func(string, int, time.Duration) { sets++ })
+	g.AddOnDeleteHook(func(string, int) { deletes++ })
+
+	value, ok := g.Compute("a", func(old int, exists bool) (int, time.Duration, ComputeOp) {
+		if exists {
+			t.Error("expected a not to exist")
+		}
+
+		return old + 1, time.Hour, ComputeSet
+	})
+	if !ok || value != 1 {
+		t.Errorf("expected value to be 1, but got %d", value)
+	}
+
+	if value, ok := g.Compute("a", func(old int, _ bool) (int, time.Duration, ComputeOp) {
+		return 100, 0, ComputeKeep
+	}); !ok || value != 1 {
+		t.Errorf("expected ComputeKeep to leave 1, but got %d", value)
+	}
+
+	exp, _ := g.PeekEntry("a")
+
+	if value, ok := g.Update("a", func(old int) int { return old * 10 }); !ok || value != 10 {
+		t.Errorf("expected value to be 10, but got %d", value)
+	}
+
+	if item, _ := g.PeekEntry("a"); !item.ExpireTime.Equal(exp.ExpireTime) {
+		t.Errorf("expected Update to keep the expiry, but got %+v", item)
+	}
+
+	if _, ok := g.Update("missing", func(old int) int { return old + 1 }); ok {
+		t.Error("expected Update not to create missing keys")
+	}
+
+	if _, ok := g.Compute("a", func(int, bool) (int, time.Duration, ComputeOp) {
+		return 0, 0, ComputeDelete
+	}); ok {
+		t.Error("expected ComputeDelete to delete a")
+	}
+
+	g.Set("b", 7, 0)
+
+	if value, ok := g.GetAndDelete("b"); !ok || value != 7 {
+		t.Errorf("expected value to be 7, but got %d", value)
+	}
+
+	if _, ok := g.GetAndDelete("b"); ok {
+		t.Error("expected b to be deleted")
+	}
+
+	if sets != 3 || deletes != 2 {
+		t.Errorf("expected 3 set and 2 delete hook calls, but got %d and %d", sets, deletes)
+	}
+
+	if g.Count() != 0 {
+		t.Errorf("expected empty cache, but got %v", g.Keys())
+	}
+
+	counters := NewSharded[string, int64](Config{}, 4)
+	defer counters.Close()
+
+	wg := sync.WaitGroup{}
+
+	for range 8 {
+		wg.Go(func() {
+			for range 1000 {
+				Increment(counters, "hits", 1, time.Hour)
+				Increment(g, "hits", 2, 0)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if value, _ := counters.Get("hits"); value != 8000 {
+		t.Errorf("expected 8000 hits, but got %d", value)
+	}
+
+	if value, _ := g.Get("hits"); value != 16000 {
+		t.Errorf("expected 16000 hits, but got %d", value)
+	}
+
+	if ttl, _ := counters.TTL("hits"); ttl <= 0 {
+		t.Errorf("expected the TTL of the first increment to be kept, but got %v", ttl)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	g := New[int, int](Config{
+		ReplacementStrategy: ReplacementStrategyFIFO,
+		MaxRecordThreshold:  10,
+		ClearNum:            3,
+	})
+	defer g.Close()
+
+	sets, gets, misses, deletes := 0, 0, 0, 0
+
+	g.AddOnSetHook(func(int, int, time.Duration) { sets++ })
+	g.AddOnGetHook(func(int, int) { gets++ })
+	g.AddOnMissHook(func(int) { misses++ })
+	g.AddOnDeleteHook(func(int, int) { deletes++ })
+
+	for i := range 8 {
+		g.Set(i, i, 0)
+	}
+
+	evictions := 0
+
+	g.AddOnEvictHook(func(_, _ int, reason EvictionReason) {
+		if reason == EvictionReasonCapacity {
+			evictions++
+		}
+	})
+
+	g.SetMany(map[int]int{7: 70, 8: 80, 9: 90, 10: 100, 11: 110}, 0) // 4 new keys, 12 > 10: evicts 3 at once
+
+	if keys := g.Keys(); !reflect.DeepEqual(keys[:5], []int{3, 4, 5, 6, 7}) || len(keys) != 9 || evictions != 3 {
+		t.Errorf("expected 0, 1 and 2 to be evicted in one pass, but got %v after %d evictions", keys, evictions)
+	}
+
+	values := g.GetMany([]int{0, 7, 8, 42})
+	if !reflect.DeepEqual(values, map[int]int{7: 70, 8: 80}) {
+		t.Errorf("expected values of 7 and 8, but got %v", values)
+	}
+
+	if deleted := g.DeleteMany([]int{7, 8, 42}); deleted != 2 {
+		t.Errorf("expected 2 deleted values, but got %d", deleted)
+	}
+
+	if sets != 13 || gets != 2 || misses != 2 || deletes != 5 {
+		t.Errorf("expected 13 set, 2 get, 2 miss and 5 delete hook calls, but got %d, %d, %d and %d", sets, gets, misses, deletes)
+	}
+
+	t.Run("existing key at the front", func(t *testing.T) {
+		for _, strategy := range []ReplacementStrategy{ReplacementStrategyFIFO, ReplacementStrategyLFU} {
+			g := New[int, int](Config{
+				ReplacementStrategy: strategy,
+				MaxRecordThreshold:  10,
+			})
+			defer g.Close()
+
+			for i := range 10 {
+				g.Set(i, i, 0)
+			}
+
+			// 0 is the next victim but part of the batch, so the values after it are evicted instead
+			g.SetMany(map[int]int{0: 0, 10: 10, 11: 11, 12: 12, 13: 13, 14: 14}, 0)
+
+			if g.Count() != 10 {
+				t.Errorf("%v: expected 10 values, but got %d: %v", strategy, g.Count(), g.Keys())
+			}
+
+			for _, key := range []int{0, 10, 11, 12, 13, 14} {
+				if _, ok := g.Get(key); !ok {
+					t.Errorf("%v: expected %d to be kept", strategy, key)
+				}
+			}
+		}
+	})
+
+	t.Run("get or load many", func(t *testing.T) {
+		g := New(Config{}, WithLoader(func(_ context.Context, key string) (string, time.Duration, error) {
+			return "single:" + key, 0, nil
+		}))
+		defer g.Close()
+
+		g.Set("a", "cached", 0)
+
+		calls := 0
+		loader := func(_ context.Context, keys []string) (map[string]string, time.Duration, error) {
+			calls++
+
+			values := map[string]string{}
+			for _, key := range keys {
+				if key != "none" {
+					values[key] = "bulk:" + key
+				}
+			}
+
+			return values, time.Hour, nil
+		}
+
+		values, err := g.GetOrLoadMany(context.Background(), []string{"a", "b", "c", "none"}, loader)
+		if err != nil || calls != 1 {
+			t.Fatalf("expected a single loader call, but got %d calls and %v", calls, err)
+		}
+
+		if !reflect.DeepEqual(values, map[string]string{"a": "cached", "b": "bulk:b", "c": "bulk:c"}) {
+			t.Errorf("expected cached and loaded values, but got %v", values)
+		}
+
+		if ttl, ok := g.TTL("b"); !ok || ttl <= 0 {
+			t.Errorf("expected b to be cached with the loader TTL, but got %v", ttl)
+		}
+
+		values, err = g.GetOrLoadMany(context.Background(), []string{"b", "d"}, nil)
+		if err != nil || !reflect.DeepEqual(values, map[string]string{"b": "bulk:b", "d": "single:d"}) {
+			t.Errorf("expected the default loader to load d, but got %v and %v", values, err)
+		}
+
+		errLoad := errors.New("backend down")
+
+		if _, err := g.GetOrLoadMany(context.Background(), []string{"e"}, func(context.Context, []string) (map[string]string, time.Duration, error) {
+			return nil, 0, errLoad
+		}); !errors.Is(err, errLoad) {
+			t.Errorf("expected loader error, but got %v", err)
+		}
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		s := NewSharded[int, int](Config{}, 4)
+		defer s.Close()
+
+		items := map[int]int{}
+		for i := range 100 {
+			items[i] = i
+		}
+
+		s.SetMany(items, 0)
+
+		if values := s.GetMany([]int{1, 2, 500}); !reflect.DeepEqual(values, map[int]int{1: 1, 2: 2}) {
+			t.Errorf("expected values of 1 and 2, but got %v", values)
+		}
+
+		if deleted := s.DeleteMany([]int{1, 2, 500}); deleted != 2 || s.Count() != 98 {
+			t.Errorf("expected 2 deleted values and 98 left, but got %d and %d", deleted, s.Count())
+		}
+
+		values, err := s.GetOrLoadMany(context.Background(), []int{1, 3}, func(_ context.Context, keys []int) (map[int]int, time.Duration, error) {
+			return map[int]int{1: -1}, 0, nil
+		})
+		if err != nil || !reflect.DeepEqual(values, map[int]int{1: -1, 3: 3}) {
+			t.Errorf("expected loaded and cached values, but got %v and %v", values, err)
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	codecs := map[string]Codec[string, int]{
+		"gob":  GobCodec[string, int]{},
+		"json": JSONCodec[string, int]{},
+	}
+
+	roundTrip := func(t *testing.T, codec Codec[string, int], cfg Config, prepare func(g *Gokachu[string, int])) (src, dst *Gokachu[string, int]) {
+		t.Helper()
+
+		src = New[string, int](cfg)
+		t.Cleanup(src.Close)
+
+		prepare(src)
+
+		var buf bytes.Buffer
+		if err := src.Snapshot(&buf, codec); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+
+		dst = New[string, int](cfg)
+		t.Cleanup(dst.Close)
+
+		if err := dst.Restore(&buf, codec); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+
+		return src, dst
+	}
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			for _, strategy := range []ReplacementStrategy{ReplacementStrategyLRU, ReplacementStrategyMRU, ReplacementStrategyLFU, ReplacementStrategyMFU} {
+				src, dst := roundTrip(t, codec, Config{ReplacementStrategy: strategy}, func(g *Gokachu[string, int]) {
+					for i, key := range []string{"a", "b", "c", "d", "e"} {
+						g.Set(key, i, time.Duration(i)*time.Hour) // "a" does not expire
+					}
+
+					for range 3 {
+						g.Get("b")
+					}
+
+					g.Get("d")
+					g.Get("a")
+				})
+
+				if !reflect.DeepEqual(dst.Keys(), src.Keys()) {
+					t.Errorf("%v: expected eviction order %v, but got %v", strategy, src.Keys(), dst.Keys())
+				}
+
+				want, got := src.Items(), dst.Items()
+				for i := range want {
+					if got[i].Key != want[i].Key || got[i].Value != want[i].Value || got[i].HitCount != want[i].HitCount ||
+						!got[i].ExpireTime.Equal(want[i].ExpireTime) || (want[i].TTL-got[i].TTL).Abs() > time.Second {
+						t.Errorf("%v: expected item %+v, but got %+v", strategy, want[i], got[i])
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("touch keeps lifetime", func(t *testing.T) {
+		_, dst := roundTrip(t, GobCodec[string, int]{}, Config{}, func(g *Gokachu[string, int]) {
+			g.Set("a", 1, time.Hour)
+			g.Expire("a", time.Minute) // the lifetime for Touch becomes a minute
+		})
+
+		if ttl := dst.store["a"].ttl; ttl != time.Minute {
+			t.Errorf("expected Touch to restart a lifetime of a minute, but got %v", ttl)
+		}
+	})
+
+	t.Run("expired values are skipped", func(t *testing.T) {
+		src := New[string, int](Config{})
+		defer src.Close()
+
+		src.Set("short", 1, 50*time.Millisecond)
+		src.Set("long", 2, time.Hour)
+
+		var buf bytes.Buffer
+		if err := src.Snapshot(&buf, GobCodec[string, int]{}); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+
+		time.Sleep(60 * time.Millisecond)
+
+		dst := New[string, int](Config{})
+		defer dst.Close()
+
+		if err := dst.Restore(&buf, GobCodec[string, int]{}); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+
+		if keys := dst.Keys(); !reflect.DeepEqual(keys, []string{"long"}) {
+			t.Errorf("expected only the unexpired key, but got %v", keys)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		_, dst := roundTrip(t, GobCodec[string, int]{}, Config{}, func(g *Gokachu[string, int]) {
+			for i, key := range []string{"a", "b", "c", "d", "e"} {
+				g.Set(key, i, 0)
+			}
+		})
+
+		small := New[string, int](Config{ReplacementStrategy: ReplacementStrategyFIFO, MaxRecordThreshold: 3})
+		defer small.Close()
+
+		var buf bytes.Buffer
+		if err := dst.Snapshot(&buf, GobCodec[string, int]{}); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+
+		if err := small.Restore(&buf, GobCodec[string, int]{}); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+
+		if keys := small.Keys(); !reflect.DeepEqual(keys, []string{"c", "d", "e"}) {
+			t.Errorf("expected the front of the eviction order to be evicted, but got %v", keys)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var valid bytes.Buffer
+
+		src := New[string, int](Config{})
+		defer src.Close()
+
+		src.Set("a", 1, 0)
+		src.Set("b", 2, 0)
+
+		if err := src.Snapshot(&valid, GobCodec[string, int]{}); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+
+		header := func(magic string, version int) []byte {
+			var buf bytes.Buffer
+			_ = json.NewEncoder(&buf).Encode(snapshotHeader{Magic: magic, Version: version})
+
+			return buf.Bytes()
+		}
+
+		streams := map[string]struct {
+			data  []byte
+			codec Codec[string, int]
+		}{
+			"empty":     {nil, GobCodec[string, int]{}},
+			"garbage":   {[]byte("not a snapshot"), GobCodec[string, int]{}},
+			"truncated": {valid.Bytes()[:valid.Len()-3], GobCodec[string, int]{}},
+			"magic":     {header("other", snapshotVersion), JSONCodec[string, int]{}},
+			"version":   {header(snapshotMagic, snapshotVersion+1), JSONCodec[string, int]{}},
+		}
+
+		for name, stream := range streams {
+			dst := New[string, int](Config{})
+			dst.Set("x", 1, 0)
+
+			if err := dst.Restore(bytes.NewReader(stream.data), stream.codec); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("%s: expected ErrInvalidSnapshot, but got %v", name, err)
+			}
+
+			if keys := dst.Keys(); !reflect.DeepEqual(keys, []string{"x"}) {
+				t.Errorf("%s: expected the cache to be left intact, but got %v", name, keys)
+			}
+
+			dst.Close()
+		}
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		src := NewSharded[string, int](Config{}, 4)
+		defer src.Close()
+
+		for i := range 20 {
+			src.Set(fmt.Sprint(i), i, time.Hour)
+		}
+
+		var buf bytes.Buffer
+		if err := src.Snapshot(&buf, JSONCodec[string, int]{}); err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+
+		dst := NewSharded[string, int](Config{}, 3)
+		defer dst.Close()
+
+		if err := dst.Restore(&buf, JSONCodec[string, int]{}); err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+
+		want, got := src.Keys(), dst.Keys()
+		slices.Sort(want)
+		slices.Sort(got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected keys %v, but got %v", want, got)
+		}
+	})
+}
+
+func TestPersist(t *testing.T) {
+	t.Run("close and new", func(t *testing.T) {
+		cfg := Config{
+			ReplacementStrategy: ReplacementStrategyLRU,
+			PersistPath:         filepath.Join(t.TempDir(), "cache"),
+		}
+
+		g := New[string, int](cfg)
+		g.Set("a", 1, 0)
+		g.Set("b", 2, time.Hour)
+		g.Set("c", 3, 50*time.Millisecond)
+		g.Get("a")
+		g.Close()
+
+		time.Sleep(60 * time.Millisecond)
+
+		g = New[string, int](cfg)
+		defer g.Close()
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"b", "a"}) {
+			t.Errorf("expected [b a] with the expired key dropped, but got %v", keys)
+		}
+
+		if ttl, _ := g.TTL("b"); ttl <= 59*time.Minute {
+			t.Errorf("expected the remaining TTL of b to be kept, but got %v", ttl)
+		}
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "cache")
+
+		g := New[string, int](Config{PersistPath: path, PersistInterval: 10 * time.Millisecond})
+		defer g.Close()
+
+		g.Set("a", 1, 0)
+
+		time.Sleep(50 * time.Millisecond)
+
+		records, err := loadFile[string, int](path, GobCodec[string, int]{})
+		if err != nil || len(records) != 1 || records[0].Key != "a" {
+			t.Errorf("expected the cache to be saved while open, but got %v, %v", records, err)
+		}
+
+		g.Close() // waits for a periodic save in progress
+
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("expected no temporary files to be left, but got %v", entries)
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache")
+
+		var header bytes.Buffer
+		_ = json.NewEncoder(&header).Encode(snapshotHeader{Magic: snapshotMagic, Version: snapshotVersion + 1})
+
+		for name, data := range map[string][]byte{"corrupt": []byte("garbage"), "version": header.Bytes()} {
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var errs []error
+
+			g := New(Config{
+				PersistPath:    path,
+				OnPersistError: func(err error) { errs = append(errs, err) },
+			}, WithPersistCodec[string, int](JSONCodec[string, int]{}))
+
+			if len(errs) != 1 || !errors.Is(errs[0], ErrInvalidSnapshot) || g.Count() != 0 {
+				t.Errorf("%s: expected an empty cache and ErrInvalidSnapshot, but got %d values and %v", name, g.Count(), errs)
+			}
+
+			g.Close()
+		}
+	})
+
+	t.Run("save error", func(t *testing.T) {
+		var errs []error
+
+		g := New[string, int](Config{
+			PersistPath:    filepath.Join(t.TempDir(), "missing", "cache"),
+			OnPersistError: func(err error) { errs = append(errs, err) },
+		})
+
+		g.Set("a", 1, 0)
+		g.Close()
+
+		if len(errs) != 1 {
+			t.Errorf("expected a save error, but got %v", errs)
+		}
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		cfg := Config{PersistPath: filepath.Join(t.TempDir(), "cache")}
+
+		s := NewSharded[string, int](cfg, 4)
+		for i := range 20 {
+			s.Set(fmt.Sprint(i), i, 0)
+		}
+
+		want := s.Keys()
+		s.Close()
+
+		s = NewSharded[string, int](cfg, 2)
+		defer s.Close()
+
+		got := s.Keys()
+		slices.Sort(want)
+		slices.Sort(got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected keys %v, but got %v", want, got)
+		}
+	})
+}
+
+func TestFlush(t *testing.T) {
+	g := New[string, string](Config{})
+	g.Set("a1", "a1", 0)
+	g.Set("a2", "a2", 0)
+	g.Set("a3", "a3", 0)
+	g.Set("b1", "b1", 0)
+	g.Set("b2", "b2", 0)
+	g.Set("b3", "b3", 0)
+	g.Set("c1", "c1", 0)
+	g.Flush()
+	if policyLen(g) != 0 {
+		t.Errorf("expected policy count to be 0, but got %d", policyLen(g))
+	}
+	if len(g.store) != 0 {
+		t.Errorf("expected store count to be 0, but got %d", len(g.store))
+	}
+	g.Close()
+}
+
+func TestGetOrLoad(t *testing.T) {
+	t.Run("load on miss", func(t *testing.T) {
+		g := New[string, string](Config{})
+		defer g.Close()
+
+		misses, sets, loads := 0, 0, 0
+
+		g.AddOnMissHook(func(_ string) { misses++ })
+		g.AddOnSetHook(func(_, _ string, _ time.Duration) { sets++ })
+
+		loader := func(_ context.Context, key string) (string, time.Duration, error) {
+			loads++
+			return "loaded-" + key, 0, nil
+		}
+
+		for range 3 {
+			v, err := g.GetOrLoad(context.Background(), "key", loader)
+			if err != nil {
+				t.Fatalf("expected no error, but got %v", err)
+			}
+
+			if v != "loaded-key" {
+				t.Errorf("expected value to be loaded-key, but got %s", v)
+			}
+		}
+
+		if loads != 1 || misses != 1 || sets != 1 {
+			t.Errorf("expected 1 load, 1 miss and 1 set, but got %d, %d and %d", loads, misses, sets)
+		}
+	})
+
+	t.Run("config loader", func(t *testing.T) {
+		g := New(Config{}, WithLoader(func(_ context.Context, key string) (int, time.Duration, error) {
+			return len(key), time.Minute, nil
+		}))
+		defer g.Close()
+
+		v, err := g.GetOrLoad(context.Background(), "four", nil)
+		if err != nil {
+			t.Fatalf("expected no error, but got %v", err)
+		}
+
+		if v != 4 {
+			t.Errorf("expected value to be 4, but got %d", v)
+		}
+	})
+
+	t.Run("loader error", func(t *testing.T) {
+		g := New[string, string](Config{})
+		defer g.Close()
+
+		errLoad := errors.New("load failed")
+
+		_, err := g.GetOrLoad(context.Background(), "key", func(_ context.Context, _ string) (string, time.Duration, error) {
+			return "", 0, errLoad
+		})
+		if !errors.Is(err, errLoad) {
+			t.Errorf("expected %v, but got %v", errLoad, err)
+		}
+
+		if g.Count() != 0 {
+			t.Errorf("expected count to be 0, but got %d", g.Count())
+		}
+	})
+
+	t.Run("loader panic", func(t *testing.T) {
+		g := New[string, string](Config{})
+		defer g.Close()
+
+		_, err := g.GetOrLoad(context.Background(), "key", func(_ context.Context, _ string) (string, time.Duration, error) {
+			panic("boom")
+		})
+		if !errors.Is(err, ErrLoaderPanic) || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("expected %v with the panic value, but got %v", ErrLoaderPanic, err)
+		}
+
+		// the failed load is forgotten, so the next miss loads again
+		v, err := g.GetOrLoad(context.Background(), "key", func(_ context.Context, _ string) (string, time.Duration, error) {
+			return "value", 0, nil
+		})
+		if err != nil || v != "value" {
+			t.Errorf("expected value and no error, but got %s and %v", v, err)
+		}
+	})
+
+	t.Run("merge concurrent misses", func(t *testing.T) {
+		g := New[string, string](Config{})
+		defer g.Close()
+
+		var loads atomic.Int32
+
+		release := make(chan struct{})
+		loader := func(_ context.Context, _ string) (string, time.Duration, error) {
+			loads.Add(1)
+			<-release
+
+			return "value", 0, nil
+		}
+
+		var wg sync.WaitGroup
+
+		for range 10 {
+			wg.Go(func() {
+				v, err := g.GetOrLoad(context.Background(), "key", loader)
+				if err != nil || v != "value" {
+					t.Errorf("expected value and no error, but got %s and %v", v, err)
+				}
+			})
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if loads.Load() != 1 {
+			t.Errorf("expected 1 load, but got %d", loads.Load())
+		}
+	})
+
+	t.Run("waiter cancel does not cancel load", func(t *testing.T) {
+		g := New[string, string](Config{})
+		defer g.Close()
+
+		release := make(chan struct{})
+		loadErr := make(chan error, 1)
+		loader := func(ctx context.Context, _ string) (string, time.Duration, error) {
+			<-release
+			loadErr <- ctx.Err()
+
+			return "value", 0, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+
+		if _, err := g.GetOrLoad(ctx, "key", loader); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, but got %v", context.Canceled, err)
+		}
+
+		close(release)
+
+		if err := <-loadErr; err != nil {
+			t.Errorf("expected load context to be alive, but got %v", err)
+		}
+
+		v, err := g.GetOrLoad(context.Background(), "key", loader)
+		if err != nil || v != "value" {
+			t.Errorf("expected value and no error, but got %s and %v", v, err)
+		}
+	})
+
+	t.Run("no loader", func(t *testing.T) {
+		g := New[string, string](Config{})
+		defer g.Close()
+
+		if _, err := g.GetOrLoad(context.Background(), "key", nil); !errors.Is(err, ErrNoLoader) {
+			t.Errorf("expected %v, but got %v", ErrNoLoader, err)
+		}
+	})
+}
+
+func TestMaxCost(t *testing.T) {
+	t.Run("weigher", func(t *testing.T) {
+		g := New(Config{
+			ReplacementStrategy: ReplacementStrategyFIFO,
+			MaxCost:             10,
+		}, WithWeigher(func(_, value string) int64 { return int64(len(value)) }))
+		defer g.Close()
+
+		g.Set("a", "1234", 0)
+		g.Set("b", "1234", 0)
+
+		if g.Cost() != 8 {
+			t.Errorf("expected cost to be 8, but got %d", g.Cost())
+		}
+
+		g.Set("c", "12345", 0) // evicts "a"
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"b", "c"}) {
+			t.Errorf("expected keys to be [b c], but got %v", keys)
+		}
+
+		if g.Cost() != 9 {
+			t.Errorf("expected cost to be 9, but got %d", g.Cost())
+		}
+
+		g.Set("d", "1", 0)
+		g.Set("d", "123456789", 0) // grows in place, evicts "b" and "c" but never itself
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"d"}) {
+			t.Errorf("expected keys to be [d], but got %v", keys)
+		}
+
+		if g.Cost() != 9 {
+			t.Errorf("expected cost to be 9, but got %d", g.Cost())
+		}
+
+		g.Delete("d")
+
+		if g.Cost() != 0 {
+			t.Errorf("expected cost to be 0, but got %d", g.Cost())
+		}
+	})
+
+	t.Run("growing the next victim", func(t *testing.T) {
+		g := New(Config{
+			ReplacementStrategy: ReplacementStrategyFIFO,
+			MaxCost:             10,
+		}, WithWeigher(func(_, value string) int64 { return int64(len(value)) }))
+		defer g.Close()
+
+		g.Set("a", "123", 0)
+		g.Set("b", "123", 0)
+		g.Set("c", "123", 0)
+		g.Set("a", "1234567", 0) // "a" is the next victim, so "b" is evicted in its place
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"a", "c"}) {
+			t.Errorf("expected keys to be [a c], but got %v", keys)
+		}
+
+		if g.Cost() != 10 {
+			t.Errorf("expected cost to be 10, but got %d", g.Cost())
+		}
+	})
+
+	t.Run("set with cost", func(t *testing.T) {
+		g := New[string, string](Config{
+			ReplacementStrategy: ReplacementStrategyLRU,
+			MaxCost:             3,
+		})
+		defer g.Close()
+
+		g.Set("a", "1", 0)
+		g.Set("b", "1", 0)
+		g.Set("c", "1", 0)
+		g.Get("a")
+
+		g.SetWithCost("d", "1", 0, 2) // evicts "b" and "c"
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []string{"a", "d"}) {
+			t.Errorf("expected keys to be [a d], but got %v", keys)
+		}
+
+		if g.Cost() != 3 {
+			t.Errorf("expected cost to be 3, but got %d", g.Cost())
+		}
+
+		g.Flush()
+
+		if g.Cost() != 0 {
+			t.Errorf("expected cost to be 0, but got %d", g.Cost())
+		}
+	})
+
+	t.Run("with threshold", func(t *testing.T) {
+		g := New[int, int](Config{
+			ReplacementStrategy: ReplacementStrategyFIFO,
+			MaxRecordThreshold:  3,
+			ClearNum:            1,
+			MaxCost:             100,
+		})
+		defer g.Close()
+
+		for i := range 5 {
+			g.Set(i, i, 0)
+		}
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []int{2, 3, 4}) {
+			t.Errorf("expected keys to be [2 3 4], but got %v", keys)
+		}
+
+		if g.Cost() != 3 {
+			t.Errorf("expected cost to be 3, but got %d", g.Cost())
+		}
+	})
+}
+
+type sizedValue int64
+
+func (v sizedValue) SizeBytes() int64 { return int64(v) }
+
+type sizedPage struct {
+	body []byte
+}
+
+func (p *sizedPage) SizeBytes() int64 { return int64(cap(p.body)) }
+
+func TestMaxMemoryBytes(t *testing.T) {
+	t.Run("estimation", func(t *testing.T) {
+		strs := New[string, string](Config{})
+		defer strs.Close()
+
+		strs.Set("a", "", 0)
+		base := strs.MemoryBytes()
+
+		strs.Set("b", "12345678", 0)
+
+		if got := strs.MemoryBytes() - base; got != base+8 {
+			t.Errorf("expected the second entry to take %d bytes, but got %d", base+8, got)
+		}
+
+		strs.Delete("a")
+		strs.Delete("b")
+
+		if strs.MemoryBytes() != 0 {
+			t.Errorf("expected memory to be 0, but got %d", strs.MemoryBytes())
+		}
+
+		bytes := New[int, []byte](Config{})
+		defer bytes.Close()
+
+		bytes.Set(1, nil, 0)
+		base = bytes.MemoryBytes()
+
+		bytes.Set(1, make([]byte, 10, 100), 0)
+
+		if got := bytes.MemoryBytes() - base; got != 100 {
+			t.Errorf("expected the capacity of the slice to be counted, but got %d", got)
+		}
+
+		sized := New[int, sizedValue](Config{})
+		defer sized.Close()
+
+		sized.Set(1, 0, 0)
+		base = sized.MemoryBytes()
+
+		sized.Set(1, 1000, 0)
+
+		if got := sized.MemoryBytes() - base; got != 1000-8 {
+			t.Errorf("expected SizeBytes to be used, but got %d more bytes", got)
+		}
+
+		// a nil pointer is not asked for its size
+		pages := New[int, *sizedPage](Config{})
+		defer pages.Close()
+
+		pages.Set(1, nil, 0)
+
+		if want := int64(reflect.TypeFor[valueWithTTL[int, *sizedPage]]().Size()) + entryOverhead; pages.MemoryBytes() != want {
+			t.Errorf("expected a nil page to take %d bytes, but got %d", want, pages.MemoryBytes())
+		}
+
+		boxed := New[int, any](Config{})
+		defer boxed.Close()
+
+		boxed.Set(1, nil, 0)
+		base = boxed.MemoryBytes()
+
+		boxed.Set(1, sizedValue(1000), 0)
+
+		if got := boxed.MemoryBytes() - base; got != 1000 {
+			t.Errorf("expected SizeBytes to be used for boxed values, but got %d more bytes", got)
+		}
+
+		boxed.Set(1, "12345", 0)
+
+		if got := boxed.MemoryBytes() - base; got != 5 {
+			t.Errorf("expected the boxed string to take 5 bytes, but got %d", got)
+		}
+
+		boxed.Set(1, (*sizedPage)(nil), 0)
+
+		if got := boxed.MemoryBytes() - base; got != 0 {
+			t.Errorf("expected a boxed nil page to take no bytes, but got %d", got)
+		}
+
+		if allocs := testing.AllocsPerRun(100, func() { strs.Set("a", "value", 0) }); allocs != 0 {
+			t.Errorf("expected no allocations on update, but got %v", allocs)
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		probe := New[int, []byte](Config{})
+		probe.Set(0, nil, 0)
+		entry := probe.MemoryBytes()
+		probe.Close()
+
+		g := New[int, []byte](Config{
+			ReplacementStrategy: ReplacementStrategyLRU,
+			MaxMemoryBytes:      3*entry + 3000,
+		})
+		defer g.Close()
+
+		for i := range 3 {
+			g.Set(i, make([]byte, 1000), 0)
+		}
+
+		g.Get(0)
+		g.Set(3, make([]byte, 1500), 0) // evicts 1 and 2
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []int{0, 3}) {
+			t.Errorf("expected keys to be [0 3], but got %v", keys)
+		}
+
+		if g.MemoryBytes() > 3*entry+3000 {
+			t.Errorf("expected memory to fit %d, but got %d", 3*entry+3000, g.MemoryBytes())
+		}
+
+		g.Set(0, make([]byte, 5000), 0) // grows in place, evicts 3 but never itself
+
+		if keys := g.Keys(); !reflect.DeepEqual(keys, []int{0}) {
+			t.Errorf("expected keys to be [0], but got %v", keys)
+		}
+
+		g.Flush()
+
+		if g.MemoryBytes() != 0 {
+			t.Errorf("expected memory to be 0, but got %d", g.MemoryBytes())
+		}
+	})
+}
+
+func TestEvictionModes(t *testing.T) {
+	fill := func(cfg Config, n int) []int {
+		cfg.ReplacementStrategy = ReplacementStrategyFIFO
+		cfg.MaxRecordThreshold = 10
+
+		g := New[int, int](cfg)
+		defer g.Close()
+
+		for i := range n {
+			g.Set(i, i, 0)
+		}
+
+		return g.Keys()
+	}
+
+	t.Run("one in one out", func(t *testing.T) {
+		keys := fill(Config{}, 15)
+		if !reflect.DeepEqual(keys, []int{5, 6, 7, 8, 9, 10, 11, 12, 13, 14}) {
+			t.Errorf("expected keys to be [5..14], but got %v", keys)
+		}
+	})
+
+	t.Run("clear num", func(t *testing.T) {
+		keys := fill(Config{ClearNum: 4}, 11)
+		if !reflect.DeepEqual(keys, []int{4, 5, 6, 7, 8, 9, 10}) {
+			t.Errorf("expected keys to be [4..10], but got %v", keys)
+		}
+	})
+
+	t.Run("low watermark", func(t *testing.T) {
+		keys := fill(Config{LowWatermarkPercent: 70}, 11)
+		if !reflect.DeepEqual(keys, []int{3, 4, 5, 6, 7, 8, 9, 10}) {
+			t.Errorf("expected keys to be [3..10], but got %v", keys)
+		}
+
+		keys = fill(Config{LowWatermarkPercent: 70}, 13)
+		if !reflect.DeepEqual(keys, []int{3, 4, 5, 6, 7, 8, 9, 10, 11, 12}) {
+			t.Errorf("expected keys to be [3..12], but got %v", keys)
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg   Config
+		valid bool
+	}{
+		"zero":                   {cfg: Config{}, valid: true},
+		"one in one out":         {cfg: Config{ReplacementStrategy: ReplacementStrategyLRU, MaxRecordThreshold: 10}, valid: true},
+		"watermark":              {cfg: Config{ReplacementStrategy: ReplacementStrategyLRU, MaxRecordThreshold: 10, LowWatermarkPercent: 80}, valid: true},
+		"threshold without":      {cfg: Config{MaxRecordThreshold: 10, ClearNum: 1}},
+		"memory without":         {cfg: Config{MaxMemoryBytes: 1 << 20}},
+		"unknown strategy":       {cfg: Config{ReplacementStrategy: 100}},
+		"negative clear num":     {cfg: Config{ReplacementStrategy: ReplacementStrategyLRU, MaxRecordThreshold: 10, ClearNum: -1}},
+		"watermark too high":     {cfg: Config{ReplacementStrategy: ReplacementStrategyLRU, MaxRecordThreshold: 10, LowWatermarkPercent: 100}},
+		"both clear modes":       {cfg: Config{ReplacementStrategy: ReplacementStrategyLRU, MaxRecordThreshold: 10, ClearNum: 1, LowWatermarkPercent: 50}},
+		"clear num without size": {cfg: Config{ReplacementStrategy: ReplacementStrategyLRU, ClearNum: 1}},
+		"negative poll interval": {cfg: Config{PollInterval: -time.Second}},
+		"persist interval alone": {cfg: Config{PersistInterval: time.Second}},
+		"2Q by cost alone":       {cfg: Config{ReplacementStrategy: ReplacementStrategy2Q, MaxCost: 10}},
+		"ARC by memory alone":    {cfg: Config{ReplacementStrategy: ReplacementStrategyARC, MaxMemoryBytes: 1 << 20}},
+		"S3-FIFO with threshold": {cfg: Config{ReplacementStrategy: ReplacementStrategyS3FIFO, MaxRecordThreshold: 10, MaxCost: 10}, valid: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("expected config to be valid, but got %v", err)
+			}
+
+			if !tt.valid && !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("expected ErrInvalidConfig, but got %v", err)
+			}
+		})
+	}
+
+	// a custom eviction policy can enforce limits without a replacement strategy, which only NewStrict sees
+	custom, err := NewStrict(Config{MaxCost: 10}, WithEvictionPolicy[string, string](func() EvictionPolicy[string] { return newListPolicy[string](false, nil) }))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+
+	custom.Close()
+
+	if _, err := NewStrict[string, string](Config{MaxRecordThreshold: 10}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig from NewStrict, but got %v", err)
+	}
+
+	if _, err := NewShardedStrict[string, string](Config{MaxRecordThreshold: 10}, 2); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig from NewShardedStrict, but got %v", err)
+	}
+
+	// New falls back to LRU to enforce a limit without a usable replacement strategy, and reports the invalid settings
+	for name, cfg := range map[string]Config{
+		"none":           {MaxRecordThreshold: 2},
+		"unknown":        {MaxRecordThreshold: 2, ReplacementStrategy: ReplacementStrategy(100), ClearNum: -1},
+		"2Q by cost":     {MaxCost: 2, ReplacementStrategy: ReplacementStrategy2Q},
+		"ARC by memory":  {MaxMemoryBytes: 1 << 20, MaxCost: 2, ReplacementStrategy: ReplacementStrategyARC},
+		"sharded (none)": {MaxRecordThreshold: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var reported error
+
+			cfg.OnConfigError = func(err error) { reported = err }
+
+			var cache interface {
+				Set(key int, v int, ttl time.Duration, hooks ...Hook)
+				Get(key int) (int, bool)
+				Keys() []int
+				Close()
+			}
+
+			if strings.HasPrefix(name, "sharded") {
+				cache = NewSharded[int, int](cfg, 1)
+			} else {
+				cache = New[int, int](cfg)
+			}
+			defer cache.Close()
+
+			if !errors.Is(reported, ErrInvalidConfig) {
+				t.Errorf("expected ErrInvalidConfig to be reported, but got %v", reported)
+			}
+
+			cache.Set(1, 1, 0)
+			cache.Set(2, 2, 0)
+			cache.Get(1)
+			cache.Set(3, 3, 0)
+
+			if keys := cache.Keys(); !slices.Equal(keys, []int{1, 3}) {
+				t.Errorf("expected keys [1 3] evicted by LRU, but got %v", keys)
+			}
+		})
+	}
+
+	var reported error
+
+	valid := New[int, int](Config{ReplacementStrategy: ReplacementStrategyLRU, MaxRecordThreshold: 2, OnConfigError: func(err error) { reported = err }})
+	valid.Close()
+
+	if reported != nil {
+		t.Errorf("expected a valid config not to be reported, but got %v", reported)
+	}
+}
+
+func TestSharded(t *testing.T) {
+	t.Run("api", func(t *testing.T) {
+		s := NewSharded[int, int](Config{
+			PollInterval: time.Hour, // expire is called manually
+		}, 4)
+		defer s.Close()
+
+		sets, deletes := atomic.Int64{}, atomic.Int64{}
+
+		setHook := s.AddOnSetHook(func(int, int, time.Duration) { sets.Add(1) })
+		s.AddOnDeleteHook(func(int, int) { deletes.Add(1) })
+
+		for i := range 100 {
+			s.Set(i, i, 0)
+		}
+
+		if count := s.Count(); count != 100 {
+			t.Errorf("expected count to be 100, but got %d", count)
+		}
+
+		expected := make([]int, 100)
+		for i := range expected {
+			expected[i] = i
+		}
+
+		keys := s.Keys()
+		slices.Sort(keys)
+
+		if !reflect.DeepEqual(keys, expected) {
+			t.Errorf("expected keys to be [0..99], but got %v", keys)
+		}
+
+		if value, ok := s.Get(42); !ok || value != 42 {
+			t.Errorf("expected value to be 42, but got %d", value)
+		}
+
+		if value, ok := s.GetFunc(func(key, _ int) bool { return key == 7 }); !ok || value != 7 {
+			t.Errorf("expected value to be 7, but got %d", value)
+		}
+
+		even := func(key, _ int) bool { return key%2 == 0 }
+
+		if count := s.CountFunc(even); count != 50 {
+			t.Errorf("expected count to be 50, but got %d", count)
+		}
+
+		if keys := s.KeysFunc(even); len(keys) != 50 {
+			t.Errorf("expected 50 keys, but got %d", len(keys))
+		}
+
+		if deleted := s.DeleteFunc(even); deleted != 50 {
+			t.Errorf("expected 50 deleted values, but got %d", deleted)
+		}
+
+		if !s.Delete(1) || s.Delete(1) {
+			t.Error("expected key 1 to be deleted once")
+		}
+
+		if !s.RemoveOnSetHook(setHook) || s.RemoveOnSetHook(setHook) {
+			t.Error("expected the set hook to be removed once")
+		}
+
+		s.Set(1000, 1000, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		s.expire()
+
+		if sets.Load() != 100 {
+			t.Errorf("expected 100 set hook calls, but got %d", sets.Load())
+		}
+
+		if deletes.Load() != 52 {
+			t.Errorf("expected 52 delete hook calls, but got %d", deletes.Load())
+		}
+
+		if flushed := s.Flush(); flushed != 49 {
+			t.Errorf("expected 49 flushed values, but got %d", flushed)
+		}
+
+		if s.Cost() != 0 || s.MemoryBytes() != 0 {
+			t.Errorf("expected empty cache, but got cost %d and memory %d", s.Cost(), s.MemoryBytes())
+		}
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		s := NewSharded[int, int](Config{
+			ReplacementStrategy: ReplacementStrategyLRU,
+			MaxRecordThreshold:  100,
+		}, 4)
+
+		for i := range 1000 {
+			s.Set(i, i, 0)
+		}
+
+		for _, shard := range s.shards {
+			if count := shard.Count(); count != 25 {
+				t.Errorf("expected every shard to hold 25 values, but got %d", count)
+			}
+		}
+
+		s.Close()
+		s.Close() // closing twice is allowed
+
+		if count := s.Count(); count != 0 {
+			t.Errorf("expected count to be 0 after close, but got %d", count)
+		}
+
+		s.Set(1, 1, 0)
+
+		if _, ok := s.Get(1); ok {
+			t.Error("expected no value to be set after close")
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		s := NewSharded[int, int](Config{
+			ReplacementStrategy: ReplacementStrategyLRU,
+			MaxRecordThreshold:  1000,
+		}, 0)
+		defer s.Close()
+
+		wg := sync.WaitGroup{}
+
+		for w := range 8 {
+			wg.Go(func() {
+				for i := range 10000 {
+					s.Set(w*10000+i%500, i, time.Second)
+					s.Get(i % 500)
+				}
+			})
+		}
+
+		wg.Wait()
+
+		if count := s.Count(); count > 1000+len(s.shards) {
+			t.Errorf("expected at most %d values, but got %d", 1000+len(s.shards), count)
+		}
+	})
+}
+
+func TestOnEvictHook(t *testing.T) {
+	g := New[string, string](Config{
+		ReplacementStrategy: ReplacementStrategyFIFO,
+		MaxRecordThreshold:  2,
+		ClearNum:            1,
+		PollInterval:        time.Hour, // expire is called manually
+	})
+
+	events := []string{}
+
+	g.AddOnEvictHook(func(key, value string, reason EvictionReason) {
+		events = append(events, key+"="+value+":"+reason.String())
+	})
+
+	g.Set("a", "1", 0)
+	g.Set("a", "2", 0)
+	g.Delete("a")
+
+	g.Set("b", "1", 0)
+	g.DeleteFunc(func(key, _ string) bool { return key == "b" })
+
+	g.Set("c", "1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	g.expire()
+
+	g.Set("d", "1", 0)
+	g.Set("e", "1", 0)
+	g.Set("f", "1", 0) // cache is full, evicts "d"
+	g.Flush()
+
+	g.Set("g", "1", 0)
+	g.Close()
+
+	expected := []string{
+		"a=1:replaced",
+		"a=2:deleted",
+		"b=1:deleted_func",
+		"c=1:expired",
+		"d=1:capacity",
+		"e=1:flushed",
+		"f=1:flushed",
+		"g=1:closed",
+	}
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events to be %v, but got %v", expected, events)
+	}
+}
+
+func TestDeleteHooksOnEveryPath(t *testing.T) {
+	run := func(cfg Config) []string {
+		cfg.ReplacementStrategy = ReplacementStrategyFIFO
+		cfg.MaxRecordThreshold = 1
+		cfg.ClearNum = 1
+
+		g := New[string, string](cfg)
+
+		deleted := []string{}
+		individual := 0
+
+		g.AddOnDeleteHook(func(key, _ string) {
+			deleted = append(deleted, key)
+		})
+
+		for _, key := range []string{"capacity", "flushed"} {
+			g.Set(key, "value", 0, WithOnDeleteHook(func() { individual++ }))
+		}
+
+		g.Flush()
+		g.Set("closed", "value", 0, WithOnDeleteHook(func() { individual++ }))
+		g.Close()
+
+		if individual != len(deleted) {
+			t.Errorf("expected individual hooks to run %d times, but got %d", len(deleted), individual)
+		}
+
+		return deleted
+	}
+
+	if deleted := run(Config{}); !reflect.DeepEqual(deleted, []string{"capacity", "flushed", "closed"}) {
+		t.Errorf("expected deleted keys to be [capacity flushed closed], but got %v", deleted)
+	}
+
+	deleted := run(Config{
+		SilentCapacityEviction: true,
+		SilentFlush:            true,
+		SilentClose:            true,
+	})
+	if len(deleted) != 0 {
+		t.Errorf("expected no deleted keys, but got %v", deleted)
+	}
+}
+
+func policyLen[K comparable, V any](g *Gokachu[K, V]) int {
+	count := 0
+
+	for range g.policy.Keys() {
+		count++
+	}
+
+	return count
+}
+
+// sortedPolicy evicts the smallest key first.
+type sortedPolicy struct {
+	keys    []int
+	inserts int
+	updates int
+	access  int
+	removes int
+}
+
+func (p *sortedPolicy) OnInsert(key int) {
+	p.inserts++
+	i, _ := slices.BinarySearch(p.keys, key)
+	p.keys = slices.Insert(p.keys, i, key)
+}
+
+func (p *sortedPolicy) OnAccess(int) { p.access++ }
+
+func (p *sortedPolicy) OnUpdate(int) { p.updates++ }
+
+func (p *sortedPolicy) OnRemove(key int) {
+	p.removes++
+	if i, ok := slices.BinarySearch(p.keys, key); ok {
+		p.keys = slices.Delete(p.keys, i, i+1)
+	}
+}
+
+func (p *sortedPolicy) Victim() (int, bool) {
+	if len(p.keys) == 0 {
+		return 0, false
+	}
+
+	return p.keys[0], true
+}
+
+func (p *sortedPolicy) Keys() iter.Seq[int] {
+	return slices.Values(p.keys)
+}
+
+func TestCustomEvictionPolicy(t *testing.T) {
+	policy := &sortedPolicy{}
+
+	g := New(Config{
+		MaxRecordThreshold: 5,
+		ClearNum:           2,
+	}, WithEvictionPolicy[int, int](func() EvictionPolicy[int] { return policy }))
+	defer g.Close()
+
+	for _, key := range []int{5, 3, 9, 1, 7} {
+		g.Set(key, key, 0)
+	}
+
+	g.Set(9, 9, 0)
+	g.Get(9)
+	g.Set(4, 4, 0) // evicts 1 and 3
+
+	if !reflect.DeepEqual(g.Keys(), []int{4, 5, 7, 9}) {
+		t.Errorf("expected keys to be [4 5 7 9], but got %v", g.Keys())
+	}
+
+	g.Delete(5)
+
+	if policy.inserts != 6 || policy.updates != 1 || policy.access != 1 || policy.removes != 3 {
+		t.Errorf("expected 6 inserts, 1 update, 1 access and 3 removes, but got %d, %d, %d and %d", policy.inserts, policy.updates, policy.access, policy.removes)
 	}
-	g.Close()
 }
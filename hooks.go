@@ -90,6 +90,46 @@ func (g *Gokachu[K, V]) runOnDeleteHooks(key K, value V) {
 	}
 }
 
+func (g *Gokachu[K, V]) AddOnEvictHook(hook func(key K, value V, reason EvictionReason)) uint64 {
+	id := g.inc.Add(1)
+	g.onEvictHooks[id] = hook
+
+	return id
+}
+
+func (g *Gokachu[K, V]) RemoveOnEvictHook(id uint64) bool {
+	_, ok := g.onEvictHooks[id]
+	if ok {
+		delete(g.onEvictHooks, id)
+	}
+
+	return ok
+}
+
+func (g *Gokachu[K, V]) runOnEvictHooks(key K, value V, reason EvictionReason) {
+	for _, hook := range g.onEvictHooks {
+		hook(key, value, reason)
+	}
+}
+
+// runRemoveHooks runs the OnDelete hooks (global and individual) and the OnEvict hooks of a removed value.
+// OnDelete hooks are skipped if they are silenced for the reason.
+func (g *Gokachu[K, V]) runRemoveHooks(value *valueWithTTL[K, V], reason EvictionReason) {
+	silent := (reason == EvictionReasonCapacity && g.silentCapacity) ||
+		(reason == EvictionReasonFlushed && g.silentFlush) ||
+		(reason == EvictionReasonClosed && g.silentClose)
+
+	if !silent {
+		g.runOnDeleteHooks(value.key, value.value)
+
+		if value.hook.OnDelete != nil {
+			value.hook.OnDelete()
+		}
+	}
+
+	g.runOnEvictHooks(value.key, value.value, reason)
+}
+
 func WithOnGetHook(hook func()) Hook {
 	return Hook{
 		OnGet: hook,
@@ -0,0 +1,102 @@
+package gokachu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoLoader is returned by GetOrLoad when neither a loader argument nor a default loader of WithLoader is given.
+var ErrNoLoader = errors.New("gokachu: no loader")
+
+// ErrLoaderPanic is returned by GetOrLoad when the loader panics. The shared load runs in its own goroutine,
+// so the panic is recovered there and returned to every waiter wrapped in this error.
+var ErrLoaderPanic = errors.New("gokachu: loader panicked")
+
+// Loader loads the value of a missing key. The returned duration is used as the TTL of the loaded value.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, time.Duration, error)
+
+// loadCall is an in-flight load shared by all GetOrLoad callers of the same key.
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// GetOrLoad gets a value from the cache. If the key does not exist, the value is loaded with the loader and set into the cache with the returned TTL.
+// If loader is nil, the default loader of WithLoader is used. The loader's error is returned as is and nothing is set into the cache.
+// A panic of the loader is returned as ErrLoaderPanic.
+//
+// Concurrent misses of the same key are merged into a single loader call and every caller gets its result.
+// The load runs with a context that is not cancelled with ctx, so a caller can stop waiting by cancelling ctx without cancelling the load for the others.
+func (g *Gokachu[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	if v, ok := g.Get(key); ok {
+		return v, nil
+	}
+
+	if loader == nil {
+		loader = g.loader
+	}
+
+	if loader == nil {
+		return *new(V), ErrNoLoader
+	}
+
+	call := g.load(ctx, key, loader)
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return *new(V), ctx.Err()
+	}
+}
+
+// load returns the in-flight load of the key or starts a new one.
+func (g *Gokachu[K, V]) load(ctx context.Context, key K, loader Loader[K, V]) *loadCall[V] {
+	g.loadMut.Lock()
+	defer g.loadMut.Unlock()
+
+	if call, ok := g.loads[key]; ok {
+		return call
+	}
+
+	call := &loadCall[V]{
+		done: make(chan struct{}),
+	}
+	g.loads[key] = call
+
+	go func() {
+		var (
+			v   V
+			ttl time.Duration
+			err error
+		)
+
+		// the call is always forgotten and completed, even if the loader panics
+		defer func() {
+			if r := recover(); r != nil {
+				v, err = *new(V), fmt.Errorf("%w: %v", ErrLoaderPanic, r)
+			}
+
+			g.loadMut.Lock()
+			delete(g.loads, key)
+			g.loadMut.Unlock()
+
+			call.value, call.err = v, err
+			close(call.done)
+		}()
+
+		v, ttl, err = loader(context.WithoutCancel(ctx), key)
+		if err != nil {
+			v = *new(V)
+			return
+		}
+
+		// set before the call is forgotten, so later callers find either the call or the value
+		g.Set(key, v, ttl)
+	}()
+
+	return call
+}
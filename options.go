@@ -0,0 +1,52 @@
+package gokachu
+
+// Option sets a typed part of the configuration, which cannot be held by Config since Config does not depend on the key
+// and value types. Options are passed to New, NewSharded and their strict variants.
+type Option[K comparable, V any] func(o *options[K, V])
+
+type options[K comparable, V any] struct {
+	loader         Loader[K, V]
+	weigher        func(key K, value V) int64
+	evictionPolicy func() EvictionPolicy[K]
+	persistCodec   Codec[K, V]
+}
+
+func newOptions[K comparable, V any](opts []Option[K, V]) options[K, V] {
+	var o options[K, V]
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithLoader sets the default loader, which GetOrLoad uses when no loader is passed to it.
+func WithLoader[K comparable, V any](loader Loader[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.loader = loader
+	}
+}
+
+// WithWeigher sets the function returning the cost of a value, see Config.MaxCost. Without a weigher every value costs 1.
+// SetWithCost overrides it for a single value.
+func WithWeigher[K comparable, V any](weigher func(key K, value V) int64) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.weigher = weigher
+	}
+}
+
+// WithEvictionPolicy sets a factory of a custom eviction policy, which is used instead of Config.ReplacementStrategy.
+// It is called once per cache (once per shard for NewSharded), so it must return a new instance on every call.
+func WithEvictionPolicy[K comparable, V any](policy func() EvictionPolicy[K]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.evictionPolicy = policy
+	}
+}
+
+// WithPersistCodec sets the codec of the file at Config.PersistPath. Without it GobCodec is used.
+func WithPersistCodec[K comparable, V any](codec Codec[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.persistCodec = codec
+	}
+}
@@ -0,0 +1,124 @@
+package gokachu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persister saves a cache to a file and loads it back, see Config.PersistPath.
+type persister[K comparable, V any] struct {
+	path     string
+	interval time.Duration
+	codec    Codec[K, V]
+	onError  func(err error)
+}
+
+func newPersister[K comparable, V any](cfg Config, codec Codec[K, V]) persister[K, V] {
+	p := persister[K, V]{
+		path:     cfg.PersistPath,
+		interval: cfg.PersistInterval,
+		codec:    codec,
+		onError:  cfg.OnPersistError,
+	}
+
+	if p.codec == nil {
+		p.codec = GobCodec[K, V]{}
+	}
+
+	return p
+}
+
+// enabled reports whether the cache is persisted.
+func (p persister[K, V]) enabled() bool {
+	return p.path != ""
+}
+
+// load reads the records of the file. A missing file has no records; other errors are reported and no records are returned.
+func (p persister[K, V]) load() []snapshotRecord[K, V] {
+	records, err := loadFile[K, V](p.path, p.codec)
+	if err != nil {
+		p.report(err)
+		return nil
+	}
+
+	return records
+}
+
+// save writes the records to the file and reports an error.
+func (p persister[K, V]) save(records []snapshotRecord[K, V]) {
+	if err := saveFile(p.path, p.codec, records); err != nil {
+		p.report(err)
+	}
+}
+
+func (p persister[K, V]) report(err error) {
+	if p.onError != nil {
+		p.onError(err)
+	}
+}
+
+// loadFile reads a snapshot from the file at path. A missing file is not an error.
+func loadFile[K comparable, V any](path string, codec Codec[K, V]) ([]snapshotRecord[K, V], error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("gokachu: load: %w", err)
+	}
+
+	defer f.Close()
+
+	records, err := readSnapshot[K, V](bufio.NewReader(f), codec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return records, nil
+}
+
+// saveFile writes a snapshot of the records to the file at path atomically: the snapshot is written to a temporary file
+// in the same directory, which then replaces the file. A failed save leaves the previous file intact.
+func saveFile[K comparable, V any](path string, codec Codec[K, V], records []snapshotRecord[K, V]) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("gokachu: persist: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+
+	if err := writeSnapshot(w, codec, records); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("gokachu: persist: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("gokachu: persist: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("gokachu: persist: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("gokachu: persist: %w", err)
+	}
+
+	return nil
+}
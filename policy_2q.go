@@ -0,0 +1,141 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+const (
+	twoQueueInPercent  = 25 // share of the capacity for the A1in queue
+	twoQueueOutPercent = 50 // size of the A1out ghost queue as a share of the capacity
+)
+
+type twoQueueSegment uint8
+
+const (
+	twoQueueA1in twoQueueSegment = iota
+	twoQueueAm
+	twoQueueA1out
+)
+
+// twoQueuePolicy implements 2Q.
+//
+// New keys enter the A1in FIFO queue and reads do not move them. Keys evicted from A1in are remembered in the A1out
+// ghost queue; a new key found in A1out was seen again shortly after its eviction, so it enters the Am LRU queue.
+// One-off keys of a scan only pass through A1in and never push the keys of Am out.
+//
+// Every queue keeps its oldest (least recently used) key in front.
+type twoQueuePolicy[K comparable] struct {
+	queues [3]*list.List // indexed by twoQueueSegment
+	store  map[K]*twoQueueEntry
+	inCap  int
+	outCap int
+	victim *K // the key returned by Victim, it goes to A1out when it is removed from A1in
+}
+
+type twoQueueEntry struct {
+	elem    *list.Element
+	segment twoQueueSegment
+}
+
+func newTwoQueuePolicy[K comparable](capacity int) *twoQueuePolicy[K] {
+	return &twoQueuePolicy[K]{
+		queues: [3]*list.List{list.New(), list.New(), list.New()},
+		store:  make(map[K]*twoQueueEntry),
+		inCap:  max(1, capacity*twoQueueInPercent/100),
+		outCap: capacity * twoQueueOutPercent / 100,
+	}
+}
+
+func (p *twoQueuePolicy[K]) OnInsert(key K) {
+	if entry, ok := p.store[key]; ok && entry.segment == twoQueueA1out {
+		p.move(key, entry, twoQueueAm)
+		return
+	}
+
+	p.store[key] = &twoQueueEntry{
+		elem:    p.queues[twoQueueA1in].PushBack(key),
+		segment: twoQueueA1in,
+	}
+}
+
+func (p *twoQueuePolicy[K]) OnAccess(key K) {
+	if entry, ok := p.store[key]; ok && entry.segment == twoQueueAm {
+		p.queues[twoQueueAm].MoveToBack(entry.elem)
+	}
+}
+
+func (p *twoQueuePolicy[K]) OnUpdate(key K) {
+	p.OnAccess(key)
+}
+
+func (p *twoQueuePolicy[K]) OnRemove(key K) {
+	entry, ok := p.store[key]
+	if !ok || entry.segment == twoQueueA1out {
+		return
+	}
+
+	// only keys evicted from A1in are remembered, deleted and expired keys are forgotten
+	if entry.segment != twoQueueA1in || p.victim == nil || *p.victim != key || p.outCap == 0 {
+		p.queues[entry.segment].Remove(entry.elem)
+		delete(p.store, key)
+		p.victim = nil
+
+		return
+	}
+
+	p.victim = nil
+	p.move(key, entry, twoQueueA1out)
+
+	for p.queues[twoQueueA1out].Len() > p.outCap {
+		oldest := p.queues[twoQueueA1out].Front()
+
+		p.queues[twoQueueA1out].Remove(oldest)
+		delete(p.store, oldest.Value.(K))
+	}
+}
+
+func (p *twoQueuePolicy[K]) Victim() (K, bool) {
+	in, am := p.queues[twoQueueA1in].Front(), p.queues[twoQueueAm].Front()
+
+	var victim *list.Element
+
+	switch {
+	case in != nil && (p.queues[twoQueueA1in].Len() > p.inCap || am == nil):
+		victim = in
+	case am != nil:
+		victim = am
+	default:
+		return *new(K), false
+	}
+
+	key := victim.Value.(K)
+	p.victim = &key
+
+	return key, true
+}
+
+func (p *twoQueuePolicy[K]) evicting(key K) {
+	p.victim = &key
+}
+
+// Keys returns keys in approximate eviction order: A1in, then Am.
+func (p *twoQueuePolicy[K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for _, l := range p.queues[:twoQueueA1out] {
+			for e := l.Front(); e != nil; e = e.Next() {
+				if !yield(e.Value.(K)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// move puts the key to the back of the segment.
+func (p *twoQueuePolicy[K]) move(key K, entry *twoQueueEntry, segment twoQueueSegment) {
+	p.queues[entry.segment].Remove(entry.elem)
+
+	entry.elem = p.queues[segment].PushBack(key)
+	entry.segment = segment
+}
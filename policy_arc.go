@@ -0,0 +1,166 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+type arcSegment uint8
+
+const (
+	arcT1 arcSegment = iota // resident, seen once
+	arcT2                   // resident, seen at least twice
+	arcB1                   // ghost, evicted from T1
+	arcB2                   // ghost, evicted from T2
+)
+
+// arcPolicy implements the Adaptive Replacement Cache.
+//
+// Resident keys are kept in T1 (seen once recently) and T2 (seen at least twice). Evicted keys are remembered without
+// values in the ghost lists B1 and B2. A new key found in B1 means T1 was too small, so the target size of T1 grows;
+// a new key found in B2 shrinks it. This balances recency and frequency without tuning.
+//
+// Every list keeps its least recently used key in front.
+type arcPolicy[K comparable] struct {
+	lists    [4]*list.List // indexed by arcSegment
+	store    map[K]*arcEntry
+	capacity int
+	target   int // target size of T1
+	victim   *K  // the key returned by Victim, it becomes a ghost when it is removed
+}
+
+type arcEntry struct {
+	elem    *list.Element
+	segment arcSegment
+}
+
+func newARCPolicy[K comparable](capacity int) *arcPolicy[K] {
+	return &arcPolicy[K]{
+		lists:    [4]*list.List{list.New(), list.New(), list.New(), list.New()},
+		store:    make(map[K]*arcEntry),
+		capacity: capacity,
+	}
+}
+
+func (p *arcPolicy[K]) OnInsert(key K) {
+	entry, ok := p.store[key]
+	if !ok {
+		p.store[key] = &arcEntry{
+			elem:    p.lists[arcT1].PushBack(key),
+			segment: arcT1,
+		}
+
+		return
+	}
+
+	b1, b2 := p.lists[arcB1].Len(), p.lists[arcB2].Len()
+
+	// ghost hit: adapt the target size of T1, then the key is seen for the second time
+	switch entry.segment {
+	case arcB1:
+		p.target = min(p.capacity, p.target+max(b2/b1, 1))
+	case arcB2:
+		p.target = max(0, p.target-max(b1/b2, 1))
+	}
+
+	p.move(key, entry, arcT2)
+}
+
+func (p *arcPolicy[K]) OnAccess(key K) {
+	if entry, ok := p.store[key]; ok && (entry.segment == arcT1 || entry.segment == arcT2) {
+		p.move(key, entry, arcT2)
+	}
+}
+
+func (p *arcPolicy[K]) OnUpdate(key K) {
+	p.OnAccess(key)
+}
+
+func (p *arcPolicy[K]) OnRemove(key K) {
+	victim := p.victim
+	p.victim = nil
+
+	entry, ok := p.store[key]
+	if !ok || entry.segment == arcB1 || entry.segment == arcB2 {
+		return
+	}
+
+	// only evicted keys are remembered, deleted and expired keys are forgotten
+	if victim == nil || *victim != key {
+		p.lists[entry.segment].Remove(entry.elem)
+		delete(p.store, key)
+
+		return
+	}
+
+	if entry.segment == arcT1 {
+		p.move(key, entry, arcB1)
+	} else {
+		p.move(key, entry, arcB2)
+	}
+
+	p.trimGhosts()
+}
+
+func (p *arcPolicy[K]) Victim() (K, bool) {
+	t1, t2 := p.lists[arcT1].Front(), p.lists[arcT2].Front()
+
+	var victim *list.Element
+
+	switch {
+	case t1 != nil && (p.lists[arcT1].Len() > p.target || t2 == nil):
+		victim = t1
+	case t2 != nil:
+		victim = t2
+	default:
+		return *new(K), false
+	}
+
+	key := victim.Value.(K)
+	p.victim = &key
+
+	return key, true
+}
+
+func (p *arcPolicy[K]) evicting(key K) {
+	p.victim = &key
+}
+
+// Keys returns resident keys in approximate eviction order: T1, then T2.
+func (p *arcPolicy[K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for _, l := range p.lists[:arcB1] {
+			for e := l.Front(); e != nil; e = e.Next() {
+				if !yield(e.Value.(K)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// move puts the key to the most recently used end of the segment.
+func (p *arcPolicy[K]) move(key K, entry *arcEntry, segment arcSegment) {
+	p.lists[entry.segment].Remove(entry.elem)
+
+	entry.elem = p.lists[segment].PushBack(key)
+	entry.segment = segment
+}
+
+// trimGhosts forgets the oldest ghosts, so that T1 and B1 hold at most capacity keys and all lists hold at most twice the capacity.
+func (p *arcPolicy[K]) trimGhosts() {
+	for p.lists[arcB1].Len() > 0 && p.lists[arcT1].Len()+p.lists[arcB1].Len() > p.capacity {
+		p.forget(arcB1)
+	}
+
+	for p.lists[arcB2].Len() > 0 && len(p.store) > 2*p.capacity {
+		p.forget(arcB2)
+	}
+}
+
+func (p *arcPolicy[K]) forget(segment arcSegment) {
+	oldest := p.lists[segment].Front()
+
+	p.lists[segment].Remove(oldest)
+	delete(p.store, oldest.Value.(K))
+}
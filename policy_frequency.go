@@ -0,0 +1,172 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+// frequencyPolicy implements LFU (least hits evicted first) and MFU (most hits evicted first) in constant time.
+//
+// Keys are grouped into frequency buckets. The buckets are kept in a list sorted by hit count in ascending order,
+// and every bucket keeps its keys in a list in the order they reached that hit count. An access moves a key to the
+// bucket of the next hit count, which is either the next bucket or a new one inserted right after the current one.
+type frequencyPolicy[K comparable] struct {
+	buckets *list.List // of *frequencyBucket, sorted by hits in ascending order
+	store   map[K]*frequencyEntry[K]
+	mfu     bool
+}
+
+type frequencyBucket[K comparable] struct {
+	hits uint
+	keys *list.List // of K, the oldest first
+}
+
+type frequencyEntry[K comparable] struct {
+	bucket *list.Element // in buckets
+	elem   *list.Element // in the bucket's keys
+}
+
+func newFrequencyPolicy[K comparable](mfu bool) *frequencyPolicy[K] {
+	return &frequencyPolicy[K]{
+		buckets: list.New(),
+		store:   make(map[K]*frequencyEntry[K]),
+		mfu:     mfu,
+	}
+}
+
+func (p *frequencyPolicy[K]) OnInsert(key K) {
+	first := p.buckets.Front()
+	if first == nil || first.Value.(*frequencyBucket[K]).hits != 0 {
+		first = p.buckets.PushFront(&frequencyBucket[K]{keys: list.New()})
+	}
+
+	p.store[key] = &frequencyEntry[K]{
+		bucket: first,
+		elem:   first.Value.(*frequencyBucket[K]).keys.PushBack(key),
+	}
+}
+
+func (p *frequencyPolicy[K]) OnAccess(key K) {
+	entry, ok := p.store[key]
+	if !ok {
+		return
+	}
+
+	current := entry.bucket.Value.(*frequencyBucket[K])
+
+	next := entry.bucket.Next()
+	if next == nil || next.Value.(*frequencyBucket[K]).hits != current.hits+1 {
+		next = p.buckets.InsertAfter(&frequencyBucket[K]{hits: current.hits + 1, keys: list.New()}, entry.bucket)
+	}
+
+	p.unlink(entry)
+
+	entry.bucket = next
+	entry.elem = next.Value.(*frequencyBucket[K]).keys.PushBack(key)
+}
+
+func (p *frequencyPolicy[K]) OnUpdate(K) {}
+
+func (p *frequencyPolicy[K]) OnRemove(key K) {
+	if entry, ok := p.store[key]; ok {
+		p.unlink(entry)
+		delete(p.store, key)
+	}
+}
+
+func (p *frequencyPolicy[K]) Victim() (K, bool) {
+	bucket := p.firstBucket()
+	if bucket == nil {
+		return *new(K), false
+	}
+
+	return bucket.Value.(*frequencyBucket[K]).keys.Front().Value.(K), true
+}
+
+func (p *frequencyPolicy[K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for bucket := p.firstBucket(); bucket != nil; bucket = p.nextBucket(bucket) {
+			for e := bucket.Value.(*frequencyBucket[K]).keys.Front(); e != nil; e = e.Next() {
+				if !yield(e.Value.(K)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// restore moves the key to the bucket of the hit count, behind the keys already there.
+func (p *frequencyPolicy[K]) restore(key K, hits uint64) {
+	entry, ok := p.store[key]
+	if !ok {
+		return
+	}
+
+	p.unlink(entry)
+
+	bucket := p.bucket(uint(hits))
+	entry.bucket = bucket
+	entry.elem = bucket.Value.(*frequencyBucket[K]).keys.PushBack(key)
+}
+
+// bucket returns the bucket of the hit count and creates it if needed. The search starts from the last bucket in eviction
+// order, where keys restored in eviction order are put.
+func (p *frequencyPolicy[K]) bucket(hits uint) *list.Element {
+	if p.mfu {
+		e := p.buckets.Front()
+		for e != nil && e.Value.(*frequencyBucket[K]).hits < hits {
+			e = e.Next()
+		}
+
+		switch {
+		case e == nil:
+			return p.buckets.PushBack(&frequencyBucket[K]{hits: hits, keys: list.New()})
+		case e.Value.(*frequencyBucket[K]).hits != hits:
+			return p.buckets.InsertBefore(&frequencyBucket[K]{hits: hits, keys: list.New()}, e)
+		}
+
+		return e
+	}
+
+	e := p.buckets.Back()
+	for e != nil && e.Value.(*frequencyBucket[K]).hits > hits {
+		e = e.Prev()
+	}
+
+	switch {
+	case e == nil:
+		return p.buckets.PushFront(&frequencyBucket[K]{hits: hits, keys: list.New()})
+	case e.Value.(*frequencyBucket[K]).hits != hits:
+		return p.buckets.InsertAfter(&frequencyBucket[K]{hits: hits, keys: list.New()}, e)
+	}
+
+	return e
+}
+
+// unlink removes the entry from its bucket and drops the bucket if it becomes empty.
+func (p *frequencyPolicy[K]) unlink(entry *frequencyEntry[K]) {
+	keys := entry.bucket.Value.(*frequencyBucket[K]).keys
+	keys.Remove(entry.elem)
+
+	if keys.Len() == 0 {
+		p.buckets.Remove(entry.bucket)
+	}
+}
+
+// firstBucket returns the bucket of the next victims.
+func (p *frequencyPolicy[K]) firstBucket() *list.Element {
+	if p.mfu {
+		return p.buckets.Back()
+	}
+
+	return p.buckets.Front()
+}
+
+// nextBucket returns the bucket which is evicted after the given bucket.
+func (p *frequencyPolicy[K]) nextBucket(bucket *list.Element) *list.Element {
+	if p.mfu {
+		return bucket.Prev()
+	}
+
+	return bucket.Next()
+}
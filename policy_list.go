@@ -0,0 +1,84 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+// listPolicy keeps keys in a linked list. The front of the list is the next victim.
+// It implements FIFO, LIFO, LRU and MRU by choosing where keys are put on insert and where they are moved on access and update.
+type listPolicy[K comparable] struct {
+	elems       *list.List // front of list == greater risk of deletion <---------list---------> back of list == less risk of deletion
+	store       map[K]*list.Element
+	insertFront bool
+	touch       func(l *list.List, e *list.Element) // moves an accessed or updated key, nil if keys do not move
+}
+
+func newListPolicy[K comparable](insertFront bool, touch func(l *list.List, e *list.Element)) *listPolicy[K] {
+	return &listPolicy[K]{
+		elems:       list.New(),
+		store:       make(map[K]*list.Element),
+		insertFront: insertFront,
+		touch:       touch,
+	}
+}
+
+func (p *listPolicy[K]) OnInsert(key K) {
+	if p.insertFront {
+		p.store[key] = p.elems.PushFront(key)
+		return
+	}
+
+	p.store[key] = p.elems.PushBack(key)
+}
+
+func (p *listPolicy[K]) OnAccess(key K) {
+	if elem, ok := p.store[key]; ok && p.touch != nil {
+		p.touch(p.elems, elem)
+	}
+}
+
+func (p *listPolicy[K]) OnUpdate(key K) {
+	p.OnAccess(key)
+}
+
+func (p *listPolicy[K]) OnRemove(key K) {
+	if elem, ok := p.store[key]; ok {
+		p.elems.Remove(elem)
+		delete(p.store, key)
+	}
+}
+
+func (p *listPolicy[K]) Victim() (K, bool) {
+	front := p.elems.Front()
+	if front == nil {
+		return *new(K), false
+	}
+
+	return front.Value.(K), true
+}
+
+func (p *listPolicy[K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for e := p.elems.Front(); e != nil; e = e.Next() {
+			if !yield(e.Value.(K)) {
+				return
+			}
+		}
+	}
+}
+
+// restore moves the key to the back of the list. Keys are restored in eviction order, so the order of the snapshot is kept.
+func (p *listPolicy[K]) restore(key K, _ uint64) {
+	if elem, ok := p.store[key]; ok {
+		p.elems.MoveToBack(elem)
+	}
+}
+
+func moveToBack(l *list.List, e *list.Element) {
+	l.MoveToBack(e)
+}
+
+func moveToFront(l *list.List, e *list.Element) {
+	l.MoveToFront(e)
+}
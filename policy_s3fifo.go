@@ -0,0 +1,180 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+const (
+	s3fifoSmallPercent = 10 // share of the capacity for the small queue
+	s3fifoMaxFreq      = 3  // access counters saturate at this value
+)
+
+type s3fifoQueue uint8
+
+const (
+	s3fifoSmall s3fifoQueue = iota
+	s3fifoMain
+	s3fifoGhost
+)
+
+// s3fifoPolicy implements S3-FIFO.
+//
+// New keys enter a small FIFO queue. When they leave it, keys accessed more than once move to the main FIFO queue,
+// the others are evicted and remembered in a ghost queue; a new key found in the ghost queue enters the main queue
+// directly. The main queue reinserts accessed keys instead of evicting them. Reads only increase a small counter of
+// the value, so Get does not move anything and needs no write lock.
+//
+// Every queue keeps its oldest key in front.
+type s3fifoPolicy[K comparable, V any] struct {
+	queues   [3]*list.List // indexed by s3fifoQueue; small and main hold *valueWithTTL, ghost holds K
+	store    map[K]*s3fifoEntry
+	values   map[K]*valueWithTTL[K, V] // the store of the cache
+	smallCap int
+	ghostCap int
+	victim   *K // the key returned by Victim, it becomes a ghost when it is removed from the small queue
+}
+
+type s3fifoEntry struct {
+	elem  *list.Element
+	queue s3fifoQueue
+}
+
+func newS3FIFOPolicy[K comparable, V any](capacity int, values map[K]*valueWithTTL[K, V]) *s3fifoPolicy[K, V] {
+	smallCap := max(1, capacity*s3fifoSmallPercent/100)
+
+	return &s3fifoPolicy[K, V]{
+		queues:   [3]*list.List{list.New(), list.New(), list.New()},
+		store:    make(map[K]*s3fifoEntry),
+		values:   values,
+		smallCap: smallCap,
+		ghostCap: max(0, capacity-smallCap),
+	}
+}
+
+func (p *s3fifoPolicy[K, V]) OnInsert(key K) {
+	value := p.values[key]
+	value.visits.Store(0)
+
+	entry, ok := p.store[key]
+	if ok && entry.queue == s3fifoGhost {
+		p.queues[s3fifoGhost].Remove(entry.elem)
+
+		entry.elem = p.queues[s3fifoMain].PushBack(value)
+		entry.queue = s3fifoMain
+
+		return
+	}
+
+	p.store[key] = &s3fifoEntry{
+		elem:  p.queues[s3fifoSmall].PushBack(value),
+		queue: s3fifoSmall,
+	}
+}
+
+func (p *s3fifoPolicy[K, V]) OnAccess(key K) {
+	entry, ok := p.store[key]
+	if !ok || entry.queue == s3fifoGhost {
+		return
+	}
+
+	visits := &entry.elem.Value.(*valueWithTTL[K, V]).visits
+
+	for {
+		freq := visits.Load()
+		if freq >= s3fifoMaxFreq || visits.CompareAndSwap(freq, freq+1) {
+			return
+		}
+	}
+}
+
+func (p *s3fifoPolicy[K, V]) OnUpdate(key K) {
+	p.OnAccess(key)
+}
+
+func (p *s3fifoPolicy[K, V]) OnRemove(key K) {
+	entry, ok := p.store[key]
+	if !ok || entry.queue == s3fifoGhost {
+		return
+	}
+
+	p.queues[entry.queue].Remove(entry.elem)
+
+	// only keys evicted from the small queue are remembered, deleted and expired keys are forgotten
+	if entry.queue != s3fifoSmall || p.victim == nil || *p.victim != key || p.ghostCap == 0 {
+		delete(p.store, key)
+		p.victim = nil
+
+		return
+	}
+
+	p.victim = nil
+	entry.elem = p.queues[s3fifoGhost].PushBack(key)
+	entry.queue = s3fifoGhost
+
+	for p.queues[s3fifoGhost].Len() > p.ghostCap {
+		oldest := p.queues[s3fifoGhost].Front()
+
+		p.queues[s3fifoGhost].Remove(oldest)
+		delete(p.store, oldest.Value.(K))
+	}
+}
+
+func (p *s3fifoPolicy[K, V]) Victim() (K, bool) {
+	small, main := p.queues[s3fifoSmall], p.queues[s3fifoMain]
+
+	for small.Len() > 0 || main.Len() > 0 {
+		if small.Len() >= p.smallCap || main.Len() == 0 {
+			oldest := small.Front()
+			value := oldest.Value.(*valueWithTTL[K, V])
+
+			if value.visits.Load() <= 1 {
+				p.victim = &value.key
+				return value.key, true
+			}
+
+			// accessed more than once, promote to the main queue
+			value.visits.Store(0)
+			small.Remove(oldest)
+
+			entry := p.store[value.key]
+			entry.elem = main.PushBack(value)
+			entry.queue = s3fifoMain
+
+			continue
+		}
+
+		oldest := main.Front()
+		value := oldest.Value.(*valueWithTTL[K, V])
+
+		if value.visits.Load() == 0 {
+			p.victim = &value.key
+			return value.key, true
+		}
+
+		// accessed, reinsert with one less access
+		value.visits.Add(^uint32(0))
+		main.MoveToBack(oldest)
+	}
+
+	return *new(K), false
+}
+
+func (p *s3fifoPolicy[K, V]) evicting(key K) {
+	p.victim = &key
+}
+
+// Keys returns keys in approximate eviction order: the small queue, then the main queue.
+func (p *s3fifoPolicy[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for _, l := range p.queues[:s3fifoGhost] {
+			for e := l.Front(); e != nil; e = e.Next() {
+				if !yield(e.Value.(*valueWithTTL[K, V]).key) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *s3fifoPolicy[K, V]) concurrentAccess() {}
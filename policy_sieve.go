@@ -0,0 +1,117 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+// sievePolicy implements SIEVE and CLOCK.
+//
+// Keys are kept in a queue and reads only set the visited bit of the value, so Get does not move anything and
+// needs no write lock. To find a victim, a hand walks from the front of the queue to the back, wrapping around,
+// clearing visited bits on its way, and stops at the first key which has not been visited. The hand keeps its
+// position between evictions.
+//
+// The two algorithms only differ in where new keys enter: SIEVE puts them to the back of the queue (the newest end),
+// CLOCK puts them right behind the hand, so they are checked last in the current round of the hand.
+type sievePolicy[K comparable, V any] struct {
+	queue *list.List // of *valueWithTTL
+	elems map[K]*list.Element
+	store map[K]*valueWithTTL[K, V] // the store of the cache
+	hand  *list.Element             // nil means the front of the queue
+	clock bool
+}
+
+func newSievePolicy[K comparable, V any](store map[K]*valueWithTTL[K, V]) *sievePolicy[K, V] {
+	return &sievePolicy[K, V]{
+		queue: list.New(),
+		elems: make(map[K]*list.Element),
+		store: store,
+	}
+}
+
+func newClockPolicy[K comparable, V any](store map[K]*valueWithTTL[K, V]) *sievePolicy[K, V] {
+	p := newSievePolicy(store)
+	p.clock = true
+
+	return p
+}
+
+func (p *sievePolicy[K, V]) OnInsert(key K) {
+	value := p.store[key]
+	value.visits.Store(0)
+
+	if p.clock && p.hand != nil {
+		p.elems[key] = p.queue.InsertBefore(value, p.hand)
+		return
+	}
+
+	p.elems[key] = p.queue.PushBack(value)
+}
+
+func (p *sievePolicy[K, V]) OnAccess(key K) {
+	if elem, ok := p.elems[key]; ok {
+		elem.Value.(*valueWithTTL[K, V]).visits.Store(1)
+	}
+}
+
+func (p *sievePolicy[K, V]) OnUpdate(key K) {
+	p.OnAccess(key)
+}
+
+func (p *sievePolicy[K, V]) OnRemove(key K) {
+	elem, ok := p.elems[key]
+	if !ok {
+		return
+	}
+
+	if p.hand == elem {
+		p.hand = elem.Next()
+	}
+
+	p.queue.Remove(elem)
+	delete(p.elems, key)
+}
+
+func (p *sievePolicy[K, V]) Victim() (K, bool) {
+	if p.queue.Len() == 0 {
+		return *new(K), false
+	}
+
+	for {
+		if p.hand == nil {
+			p.hand = p.queue.Front()
+		}
+
+		value := p.hand.Value.(*valueWithTTL[K, V])
+		if value.visits.Swap(0) == 0 {
+			return value.key, true
+		}
+
+		p.hand = p.hand.Next()
+	}
+}
+
+// Keys returns keys in approximate eviction order: from the hand to the back of the queue, then from the front to the hand.
+func (p *sievePolicy[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		start := p.hand
+		if start == nil {
+			start = p.queue.Front()
+		}
+
+		for e := start; e != nil; e = e.Next() {
+			if !yield(e.Value.(*valueWithTTL[K, V]).key) {
+				return
+			}
+		}
+
+		for e := p.queue.Front(); e != nil && e != start; e = e.Next() {
+			if !yield(e.Value.(*valueWithTTL[K, V]).key) {
+				return
+			}
+		}
+	}
+}
+
+func (p *sievePolicy[K, V]) concurrentAccess() {}
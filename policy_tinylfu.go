@@ -0,0 +1,169 @@
+package gokachu
+
+import (
+	"container/list"
+	"iter"
+)
+
+const (
+	tinyLFUWindowPercent    = 1  // share of the capacity for the window segment
+	tinyLFUProtectedPercent = 80 // share of the main segment for the protected segment
+)
+
+type tinyLFUSegment uint8
+
+const (
+	tinyLFUWindow tinyLFUSegment = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+// tinyLFUPolicy implements W-TinyLFU as used by Caffeine and Ristretto.
+//
+// New keys enter a small LRU window. Keys leaving the window enter the probation part of a segmented LRU, and keys
+// accessed on probation are promoted to its protected part. When the cache is full, the oldest key of the window
+// competes with the oldest key of the main segment, and the one seen less often according to a count-min sketch is evicted.
+// This way one-off keys of a scan can not push popular keys out of the cache.
+//
+// Every list keeps its oldest key in front.
+type tinyLFUPolicy[K comparable] struct {
+	window       *list.List
+	probation    *list.List
+	protected    *list.List
+	store        map[K]*tinyLFUEntry
+	sketch       *countMinSketch[K]
+	windowCap    int
+	protectedCap int
+}
+
+type tinyLFUEntry struct {
+	elem    *list.Element
+	segment tinyLFUSegment
+}
+
+func newTinyLFUPolicy[K comparable](capacity int) *tinyLFUPolicy[K] {
+	windowCap := max(1, capacity*tinyLFUWindowPercent/100)
+
+	return &tinyLFUPolicy[K]{
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		store:        make(map[K]*tinyLFUEntry),
+		sketch:       newCountMinSketch[K](capacity),
+		windowCap:    windowCap,
+		protectedCap: max(0, capacity-windowCap) * tinyLFUProtectedPercent / 100,
+	}
+}
+
+func (p *tinyLFUPolicy[K]) OnInsert(key K) {
+	p.sketch.increment(key)
+
+	p.store[key] = &tinyLFUEntry{
+		elem:    p.window.PushBack(key),
+		segment: tinyLFUWindow,
+	}
+
+	// the oldest key of a full window moves to probation
+	if p.window.Len() > p.windowCap {
+		oldest := p.window.Front()
+		entry := p.store[oldest.Value.(K)]
+
+		p.window.Remove(oldest)
+		entry.elem = p.probation.PushBack(oldest.Value.(K))
+		entry.segment = tinyLFUProbation
+	}
+}
+
+func (p *tinyLFUPolicy[K]) OnAccess(key K) {
+	p.sketch.increment(key)
+
+	entry, ok := p.store[key]
+	if !ok {
+		return
+	}
+
+	switch entry.segment {
+	case tinyLFUWindow:
+		p.window.MoveToBack(entry.elem)
+	case tinyLFUProtected:
+		p.protected.MoveToBack(entry.elem)
+	case tinyLFUProbation:
+		p.probation.Remove(entry.elem)
+		entry.elem = p.protected.PushBack(key)
+		entry.segment = tinyLFUProtected
+
+		// the oldest key of a full protected segment goes back to probation
+		if p.protected.Len() > p.protectedCap {
+			oldest := p.protected.Front()
+			demoted := p.store[oldest.Value.(K)]
+
+			p.protected.Remove(oldest)
+			demoted.elem = p.probation.PushBack(oldest.Value.(K))
+			demoted.segment = tinyLFUProbation
+		}
+	}
+}
+
+func (p *tinyLFUPolicy[K]) OnUpdate(key K) {
+	p.OnAccess(key)
+}
+
+func (p *tinyLFUPolicy[K]) OnRemove(key K) {
+	entry, ok := p.store[key]
+	if !ok {
+		return
+	}
+
+	p.segment(entry.segment).Remove(entry.elem)
+	delete(p.store, key)
+}
+
+func (p *tinyLFUPolicy[K]) Victim() (K, bool) {
+	candidate := p.window.Front()
+
+	victim := p.probation.Front()
+	if victim == nil {
+		victim = p.protected.Front()
+	}
+
+	switch {
+	case victim == nil && candidate == nil:
+		return *new(K), false
+	case victim == nil:
+		return candidate.Value.(K), true
+	case candidate == nil || p.window.Len() < p.windowCap:
+		// the window has room, so the main segment makes room
+		return victim.Value.(K), true
+	}
+
+	// admission: the window candidate enters the main segment only if it is seen more often than the main victim
+	if p.sketch.estimate(candidate.Value.(K)) > p.sketch.estimate(victim.Value.(K)) {
+		return victim.Value.(K), true
+	}
+
+	return candidate.Value.(K), true
+}
+
+// Keys returns keys in approximate eviction order: probation, window and protected segments, the oldest first in each.
+func (p *tinyLFUPolicy[K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for _, l := range []*list.List{p.probation, p.window, p.protected} {
+			for e := l.Front(); e != nil; e = e.Next() {
+				if !yield(e.Value.(K)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *tinyLFUPolicy[K]) segment(segment tinyLFUSegment) *list.List {
+	switch segment {
+	case tinyLFUProbation:
+		return p.probation
+	case tinyLFUProtected:
+		return p.protected
+	default:
+		return p.window
+	}
+}
@@ -1,40 +1,64 @@
 package gokachu
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
-// poll deletes expired values from the cache with the given poll interval. If context is cancelled, the polling stops.
-func (g *Gokachu[K, V]) poll() {
-	ticker := time.NewTicker(g.pollInterval)
+// expireBatchSize is the maximum number of expired values deleted in one hold of the write lock.
+const expireBatchSize = 1024
+
+// poll calls expire with the given poll interval until cancel is closed.
+func poll(interval time.Duration, cancel <-chan struct{}, wg *sync.WaitGroup, expire func()) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-g.pollCancel: // when Close method called, polling stops
-			g.pollCancel = nil
-			g.wg.Done()
-
+		case <-cancel: // when Close method called, polling stops
 			return
 
 		case <-ticker.C:
-			g.mut.Lock()
+			expire()
+		}
+	}
+}
+
+// expire deletes expired values in batches of expireBatchSize, taking them from the expiration heap.
+// The write lock is released between batches, so a large number of expired values does not block readers for the whole pass.
+func (g *Gokachu[K, V]) expire() {
+	for {
+		g.mut.Lock()
 
-			now := time.Now()
+		now := time.Now()
+		deleted := 0
 
-			for key := range g.store {
-				elem := g.store[key]
+		for deleted < expireBatchSize && g.expirations.hasExpired(now) {
+			g.deleteExpired(g.expirations.peek())
 
-				// elem must be non-expired
-				if elem.Value.(*valueWithTTL[K, V]).expireTime.IsZero() || elem.Value.(*valueWithTTL[K, V]).expireTime.After(now) {
-					continue
-				}
+			deleted++
+		}
 
-				// delete expired element
-				g.runOnDeleteHooks(key, elem.Value.(*valueWithTTL[K, V]).value)
-				g.elems.Remove(elem)
-				delete(g.store, key)
-			}
+		g.mut.Unlock()
 
-			g.mut.Unlock()
+		if deleted < expireBatchSize {
+			return
 		}
 	}
 }
+
+// deleteExpired deletes an expired value from the cache. The write lock must be held.
+func (g *Gokachu[K, V]) deleteExpired(value *valueWithTTL[K, V]) {
+	g.remove(value, EvictionReasonExpired)
+}
+
+// deleteIfExpired deletes the value of the key if it is expired.
+func (g *Gokachu[K, V]) deleteIfExpired(key K) {
+	defer g.lock()()
+
+	if value, ok := g.store[key]; ok && value.expired(time.Now()) {
+		g.deleteExpired(value)
+	}
+}
@@ -1,62 +1,159 @@
 package gokachu
 
-import "container/list"
+import "iter"
 
 type ReplacementStrategy uint
 
+// Replacement strategies. W-TinyLFU, ARC, S3-FIFO and 2Q require MaxRecordThreshold to size their queues; with only
+// MaxCost or MaxMemoryBytes, New falls back to ReplacementStrategyLRU for them, see New.
 const (
-	ReplacementStrategyNone ReplacementStrategy = iota
-	ReplacementStrategyLRU                      // Least Recently Used
-	ReplacementStrategyMRU                      // Most Recently Used
-	ReplacementStrategyFIFO                     // First In First Out
-	ReplacementStrategyLIFO                     // Last In First Out
-	ReplacementStrategyLFU                      // Least Frequently Used
-	ReplacementStrategyMFU                      // Most Frequently Used
+	ReplacementStrategyNone    ReplacementStrategy = iota // No eviction, New falls back to LRU if a limit is set
+	ReplacementStrategyLRU                                // Least Recently Used
+	ReplacementStrategyMRU                                // Most Recently Used
+	ReplacementStrategyFIFO                               // First In First Out
+	ReplacementStrategyLIFO                               // Last In First Out
+	ReplacementStrategyLFU                                // Least Frequently Used
+	ReplacementStrategyMFU                                // Most Frequently Used
+	ReplacementStrategyTinyLFU                            // Window TinyLFU, scan resistant admission by frequency; LRU without MaxRecordThreshold
+	ReplacementStrategyARC                                // Adaptive Replacement Cache, balances recency and frequency; LRU without MaxRecordThreshold
+	ReplacementStrategySIEVE                              // SIEVE, FIFO with a visited bit and a moving hand
+	ReplacementStrategyS3FIFO                             // S3-FIFO, small, main and ghost FIFO queues; LRU without MaxRecordThreshold
+	ReplacementStrategy2Q                                 // 2Q, A1in FIFO, A1out ghost queue and Am LRU; LRU without MaxRecordThreshold
+	ReplacementStrategyCLOCK                              // CLOCK, second chance approximation of LRU
 )
 
-func (g *Gokachu[K, V]) clear() {
-	currentElem := g.elems.Front()
+// sizedByThreshold reports whether the policy of the strategy sizes its segments and ghost queues by MaxRecordThreshold,
+// so it cannot work as designed with MaxCost or MaxMemoryBytes alone.
+func (s ReplacementStrategy) sizedByThreshold() bool {
+	switch s {
+	case ReplacementStrategyTinyLFU, ReplacementStrategyARC, ReplacementStrategyS3FIFO, ReplacementStrategy2Q:
+		return true
+	default:
+		return false
+	}
+}
+
+// newPolicy returns the built-in eviction policy of the replacement strategy for a cache of the given capacity and store.
+// ReplacementStrategyNone keeps keys in insertion order, but the cache never asks it for a victim.
+func newPolicy[K comparable, V any](strategy ReplacementStrategy, capacity int, store map[K]*valueWithTTL[K, V]) EvictionPolicy[K] {
+	switch strategy {
+	case ReplacementStrategyLRU:
+		return newListPolicy[K](false, moveToBack)
+	case ReplacementStrategyMRU:
+		return newListPolicy[K](true, moveToFront)
+	case ReplacementStrategyLIFO:
+		return newListPolicy[K](true, nil)
+	case ReplacementStrategyLFU:
+		return newFrequencyPolicy[K](false)
+	case ReplacementStrategyMFU:
+		return newFrequencyPolicy[K](true)
+	case ReplacementStrategyTinyLFU:
+		return newTinyLFUPolicy[K](capacity)
+	case ReplacementStrategyARC:
+		return newARCPolicy[K](capacity)
+	case ReplacementStrategySIEVE:
+		return newSievePolicy(store)
+	case ReplacementStrategyS3FIFO:
+		return newS3FIFOPolicy(capacity, store)
+	case ReplacementStrategy2Q:
+		return newTwoQueuePolicy[K](capacity)
+	case ReplacementStrategyCLOCK:
+		return newClockPolicy(store)
+	default: // ReplacementStrategyNone, ReplacementStrategyFIFO
+		return newListPolicy[K](false, nil)
+	}
+}
 
-	deletedCount := 0
-	for deletedCount < g.clearNum && currentElem != nil {
-		delete(g.store, currentElem.Value.(*valueWithTTL[K, V]).key)
-		nextElem := currentElem.Next()
-		g.elems.Remove(currentElem)
+// makeRoom evicts values chosen by the eviction policy, so that the given number of new values with the given total cost
+// and size fit into the limits. Protected keys are never evicted: they are skipped for the next keys in eviction order.
+// The write lock must be held.
+func (g *Gokachu[K, V]) makeRoom(protected func(key K) bool, count int, cost, size int64) {
+	if !g.evictable {
+		return
+	}
 
-		deletedCount++
-		currentElem = nextElem
+	// clear if cache is full
+	if g.maxRecordThreshold > 0 && len(g.store)+count > g.maxRecordThreshold {
+		g.clear(protected, count)
 	}
+
+	// clear if the cost or size does not fit
+	g.clearToFit(protected, cost, size)
 }
 
-func (g *Gokachu[K, V]) moveByHits(elem *list.Element) {
-	prev := elem.Prev()
-	next := elem.Next()
+// clear makes room for new values when MaxRecordThreshold is reached. It evicts clearNum values at a time, or down to
+// the low watermark, or just one value for each new one if neither is set. The write lock must be held.
+func (g *Gokachu[K, V]) clear(protected func(key K) bool, count int) {
+	target := g.maxRecordThreshold - count // one in, one out
 
-	switch g.replacementStrategy {
-	case ReplacementStrategyLFU:
-		if prev != nil && prev.Value.(*valueWithTTL[K, V]).hitCount > elem.Value.(*valueWithTTL[K, V]).hitCount {
-			g.elems.MoveBefore(elem, prev)
-			g.moveByHits(elem)
+	switch {
+	case g.clearNum > 0:
+		target = len(g.store) - g.clearNum*divideUp(len(g.store)+count-g.maxRecordThreshold, g.clearNum)
+	case g.lowWatermark > 0:
+		target = min(g.maxRecordThreshold*g.lowWatermark/100, g.maxRecordThreshold-count)
+	}
 
+	for len(g.store) > target {
+		if !g.evict(protected) {
 			return
 		}
+	}
+}
 
-		if next != nil && next.Value.(*valueWithTTL[K, V]).hitCount < elem.Value.(*valueWithTTL[K, V]).hitCount {
-			g.elems.MoveAfter(elem, next)
-			g.moveByHits(elem)
+// clearToFit evicts values chosen by the eviction policy until the total cost and memory, plus the incoming ones,
+// fit into MaxCost and MaxMemoryBytes. Protected keys are never evicted, so the cache may exceed the limits if they
+// do not fit alone. The write lock must be held.
+func (g *Gokachu[K, V]) clearToFit(protected func(key K) bool, cost, size int64) {
+	for g.maxCost > 0 && g.cost+cost > g.maxCost || g.maxMemory > 0 && g.memory+size > g.maxMemory {
+		if !g.evict(protected) {
+			return
 		}
+	}
+}
 
-	case ReplacementStrategyMFU:
-		if prev != nil && prev.Value.(*valueWithTTL[K, V]).hitCount < elem.Value.(*valueWithTTL[K, V]).hitCount {
-			g.elems.MoveBefore(elem, prev)
-			g.moveByHits(elem)
+// evict evicts the next victim of the eviction policy. A protected victim is skipped for the first key in eviction order
+// which is not protected. Returns false if there is no key to evict. The write lock must be held.
+func (g *Gokachu[K, V]) evict(protected func(key K) bool) bool {
+	victim, ok := g.policy.Victim()
+	if ok && protected(victim) {
+		victim, ok = g.unprotected(protected)
+	}
 
-			return
+	if !ok {
+		return false
+	}
+
+	if policy, ok := g.policy.(evictingPolicy[K]); ok {
+		policy.evicting(victim)
+	}
+
+	value, ok := g.store[victim]
+	if !ok {
+		// the policy is out of sync with the store, forget the key
+		g.policy.OnRemove(victim)
+		return true
+	}
+
+	g.remove(value, EvictionReasonCapacity)
+
+	return true
+}
+
+// unprotected returns the first key in eviction order which is not protected. Returns false if all keys are protected.
+// The write lock must be held.
+func (g *Gokachu[K, V]) unprotected(protected func(key K) bool) (K, bool) {
+	// pulled rather than ranged over, so protected is not captured by a closure and does not escape to the heap on every Set
+	next, stop := iter.Pull(g.policy.Keys())
+	defer stop()
+
+	for {
+		key, ok := next()
+		if !ok {
+			return *new(K), false
 		}
 
-		if next != nil && next.Value.(*valueWithTTL[K, V]).hitCount > elem.Value.(*valueWithTTL[K, V]).hitCount {
-			g.elems.MoveAfter(elem, next)
-			g.moveByHits(elem)
+		if !protected(key) {
+			return key, true
 		}
 	}
 }
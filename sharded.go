@@ -0,0 +1,559 @@
+package gokachu
+
+import (
+	"cmp"
+	"context"
+	"hash/maphash"
+	"io"
+	"iter"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sharded is a cache split into independent Gokachu shards by the hash of the key, so operations on different shards
+// do not wait for each other. It has the same API as Gokachu.
+//
+// Each shard applies the replacement strategy and the limits of the configuration on its own, so eviction order is
+// only kept within a shard. Expired values of all shards are deleted by a single poll goroutine.
+type Sharded[K comparable, V any] struct {
+	shards     []*Gokachu[K, V]
+	seed       maphash.Seed
+	mut        *sync.Mutex
+	pollCancel chan struct{}
+	wg         *sync.WaitGroup
+	persister  persister[K, V]
+
+	// Hooks
+	inc   atomic.Uint64
+	hooks map[uint64][]uint64 // hook IDs of the shards by the ID returned to the user
+}
+
+// NewSharded creates a cache with the given number of shards. If shards is 0 or negative, runtime.GOMAXPROCS(0) is used.
+// MaxRecordThreshold, ClearNum, MaxCost and MaxMemoryBytes are divided evenly between the shards, rounded up.
+// If Config.PersistPath is set, all shards are saved to and loaded from that single file.
+// Do not forgot call Close() function before exit. It falls back from the settings Config.Validate reports like New.
+func NewSharded[K comparable, V any](cfg Config, shards int, opts ...Option[K, V]) *Sharded[K, V] {
+	o := newOptions(opts)
+
+	return newSharded(cfg.usable(o.evictionPolicy != nil), shards, o)
+}
+
+// NewShardedStrict creates a sharded cache like NewSharded, but returns an error matching ErrInvalidConfig if the
+// configuration cannot work as intended, see Config.Validate.
+func NewShardedStrict[K comparable, V any](cfg Config, shards int, opts ...Option[K, V]) (*Sharded[K, V], error) {
+	o := newOptions(opts)
+
+	if err := cfg.validate(o.evictionPolicy != nil); err != nil {
+		return nil, err
+	}
+
+	return newSharded(cfg, shards, o), nil
+}
+
+func newSharded[K comparable, V any](cfg Config, shards int, o options[K, V]) *Sharded[K, V] {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+
+	shardCfg := cfg
+	shardCfg.MaxRecordThreshold = divideUp(cfg.MaxRecordThreshold, shards)
+	shardCfg.ClearNum = divideUp(cfg.ClearNum, shards)
+	shardCfg.MaxCost = divideUp(cfg.MaxCost, int64(shards))
+	shardCfg.MaxMemoryBytes = divideUp(cfg.MaxMemoryBytes, int64(shards))
+	shardCfg.PersistPath, shardCfg.PersistInterval = "", 0 // persisted by the Sharded as a whole
+
+	s := &Sharded[K, V]{
+		shards:     make([]*Gokachu[K, V], shards),
+		seed:       maphash.MakeSeed(),
+		mut:        new(sync.Mutex),
+		pollCancel: make(chan struct{}),
+		wg:         new(sync.WaitGroup),
+		hooks:      make(map[uint64][]uint64),
+		persister:  newPersister[K, V](cfg, o.persistCodec),
+	}
+
+	for i := range s.shards {
+		s.shards[i] = newGokachu(shardCfg, o)
+	}
+
+	if s.persister.enabled() {
+		s.restore(s.persister.load())
+	}
+
+	s.wg.Add(1)
+
+	go poll(cmp.Or(cfg.PollInterval, time.Second), s.pollCancel, s.wg, s.expire)
+
+	if s.persister.interval > 0 {
+		s.wg.Add(1)
+
+		go poll(s.persister.interval, s.pollCancel, s.wg, func() { s.persister.save(s.records()) })
+	}
+
+	return s
+}
+
+// Set sets a value in the cache with a TTL. If the TTL is 0, the value will not expire.
+func (s *Sharded[K, V]) Set(key K, v V, ttl time.Duration, hooks ...Hook) {
+	s.shard(key).Set(key, v, ttl, hooks...)
+}
+
+// SetWithCost sets a value in the cache with a TTL and a cost, which overrides the weigher of WithWeigher for this value.
+// If the TTL is 0, the value will not expire.
+func (s *Sharded[K, V]) SetWithCost(key K, v V, ttl time.Duration, cost int64, hooks ...Hook) {
+	s.shard(key).SetWithCost(key, v, ttl, cost, hooks...)
+}
+
+// SetIfAbsent sets a value only if the key does not exist. See Gokachu.SetIfAbsent.
+func (s *Sharded[K, V]) SetIfAbsent(key K, v V, ttl time.Duration, hooks ...Hook) bool {
+	return s.shard(key).SetIfAbsent(key, v, ttl, hooks...)
+}
+
+// Replace sets a value only if the key exists. See Gokachu.Replace.
+func (s *Sharded[K, V]) Replace(key K, v V, ttl time.Duration, hooks ...Hook) bool {
+	return s.shard(key).Replace(key, v, ttl, hooks...)
+}
+
+// CompareAndSwap swaps the value of the key if it equals oldValue. See Gokachu.CompareAndSwap.
+func (s *Sharded[K, V]) CompareAndSwap(key K, oldValue, newValue V, eq func(a, b V) bool) bool {
+	return s.shard(key).CompareAndSwap(key, oldValue, newValue, eq)
+}
+
+// CompareAndDelete deletes the value of the key if it equals oldValue. See Gokachu.CompareAndDelete.
+func (s *Sharded[K, V]) CompareAndDelete(key K, oldValue V, eq func(a, b V) bool) bool {
+	return s.shard(key).CompareAndDelete(key, oldValue, eq)
+}
+
+// Compute reads, computes and writes the entry of the key atomically. See Gokachu.Compute.
+func (s *Sharded[K, V]) Compute(key K, fn ComputeFunc[V]) (V, bool) {
+	return s.shard(key).Compute(key, fn)
+}
+
+// Update sets the value of the key to the result of fn atomically. See Gokachu.Update.
+func (s *Sharded[K, V]) Update(key K, fn func(old V) V) (V, bool) {
+	return s.shard(key).Update(key, fn)
+}
+
+// GetAndDelete deletes the value of the key and returns it. See Gokachu.GetAndDelete.
+func (s *Sharded[K, V]) GetAndDelete(key K) (V, bool) {
+	return s.shard(key).GetAndDelete(key)
+}
+
+// Get gets a value from the cache. Returns false in second value if the key does not exist or is expired.
+func (s *Sharded[K, V]) Get(key K) (V, bool) {
+	return s.shard(key).Get(key)
+}
+
+// Peek gets a value from the cache without any side effect. See Gokachu.Peek.
+func (s *Sharded[K, V]) Peek(key K) (V, bool) {
+	return s.shard(key).Peek(key)
+}
+
+// PeekEntry gets a snapshot of a value with its expiry time, remaining TTL and hit count. See Gokachu.PeekEntry.
+func (s *Sharded[K, V]) PeekEntry(key K) (Item[K, V], bool) {
+	return s.shard(key).PeekEntry(key)
+}
+
+// TTL returns the remaining lifetime of a value. See Gokachu.TTL.
+func (s *Sharded[K, V]) TTL(key K) (time.Duration, bool) {
+	return s.shard(key).TTL(key)
+}
+
+// Expire sets the TTL of a value. See Gokachu.Expire.
+func (s *Sharded[K, V]) Expire(key K, ttl time.Duration) bool {
+	return s.shard(key).Expire(key, ttl)
+}
+
+// ExpireAt sets the expiry time of a value. See Gokachu.ExpireAt.
+func (s *Sharded[K, V]) ExpireAt(key K, t time.Time) bool {
+	return s.shard(key).ExpireAt(key, t)
+}
+
+// Persist removes the expiry of a value. See Gokachu.Persist.
+func (s *Sharded[K, V]) Persist(key K) bool {
+	return s.shard(key).Persist(key)
+}
+
+// Touch restarts the lifetime of a value. See Gokachu.Touch.
+func (s *Sharded[K, V]) Touch(key K) bool {
+	return s.shard(key).Touch(key)
+}
+
+// GetFunc retrieves a first matching value from the cache using a callback function. If all matches return false, the second value also returns false.
+func (s *Sharded[K, V]) GetFunc(cb func(key K, value V) bool) (V, bool) {
+	for _, shard := range s.shards {
+		if value, ok := shard.GetFunc(cb); ok {
+			return value, true
+		}
+	}
+
+	return *new(V), false
+}
+
+// GetOrLoad returns the value of the key, or loads it on a miss. See Gokachu.GetOrLoad.
+func (s *Sharded[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	return s.shard(key).GetOrLoad(ctx, key, loader)
+}
+
+// SetMany sets values in the cache with a TTL, taking the lock of each shard once. See Gokachu.SetMany.
+func (s *Sharded[K, V]) SetMany(items map[K]V, ttl time.Duration) {
+	batches := make(map[*Gokachu[K, V]]map[K]V)
+
+	for key, v := range items {
+		shard := s.shard(key)
+		if batches[shard] == nil {
+			batches[shard] = make(map[K]V)
+		}
+
+		batches[shard][key] = v
+	}
+
+	for shard, batch := range batches {
+		shard.SetMany(batch, ttl)
+	}
+}
+
+// GetMany gets the values of the keys, taking the lock of each shard once. See Gokachu.GetMany.
+func (s *Sharded[K, V]) GetMany(keys []K) map[K]V {
+	values := make(map[K]V, len(keys))
+
+	for shard, batch := range s.group(keys) {
+		for key, v := range shard.GetMany(batch) {
+			values[key] = v
+		}
+	}
+
+	return values
+}
+
+// DeleteMany deletes the values of the keys, taking the lock of each shard once. See Gokachu.DeleteMany.
+func (s *Sharded[K, V]) DeleteMany(keys []K) int {
+	count := 0
+
+	for shard, batch := range s.group(keys) {
+		count += shard.DeleteMany(batch)
+	}
+
+	return count
+}
+
+// GetOrLoadMany gets the values of the keys, and loads the missing ones with a single call of the bulk loader.
+// See Gokachu.GetOrLoadMany.
+func (s *Sharded[K, V]) GetOrLoadMany(ctx context.Context, keys []K, loader BulkLoader[K, V]) (map[K]V, error) {
+	return getOrLoadMany(ctx, s, keys, loader)
+}
+
+// Snapshot writes all values of the cache to w with the codec. Values are grouped by shard, in eviction order within
+// a shard. See Gokachu.Snapshot.
+func (s *Sharded[K, V]) Snapshot(w io.Writer, codec Codec[K, V]) error {
+	return writeSnapshot(w, codec, s.records())
+}
+
+// Restore reads a snapshot from r and sets its values in the shards of their keys, keeping their order within a shard.
+// The snapshot may come from a cache with another number of shards or from a Gokachu. See Gokachu.Restore.
+func (s *Sharded[K, V]) Restore(r io.Reader, codec Codec[K, V]) error {
+	records, err := readSnapshot[K, V](r, codec)
+	if err != nil {
+		return err
+	}
+
+	s.restore(records)
+
+	return nil
+}
+
+// records returns the snapshot records of all shards.
+func (s *Sharded[K, V]) records() []snapshotRecord[K, V] {
+	records := []snapshotRecord[K, V]{}
+
+	for _, shard := range s.shards {
+		records = append(records, shard.records()...)
+	}
+
+	return records
+}
+
+// restore sets the records in the shards of their keys, keeping their order within a shard.
+func (s *Sharded[K, V]) restore(records []snapshotRecord[K, V]) {
+	batches := make(map[*Gokachu[K, V]][]snapshotRecord[K, V])
+
+	for _, record := range records {
+		shard := s.shard(record.Key)
+		batches[shard] = append(batches[shard], record)
+	}
+
+	for shard, batch := range batches {
+		shard.restore(batch)
+	}
+}
+
+// Delete deletes a value from the cache and returns true if the key existed.
+func (s *Sharded[K, V]) Delete(key K) bool {
+	return s.shard(key).Delete(key)
+}
+
+// DeleteFunc deletes values from the cache for which the callback returns true and returns the number of deleted values.
+func (s *Sharded[K, V]) DeleteFunc(cb func(key K, value V) bool) int {
+	return s.sum(func(shard *Gokachu[K, V]) int { return shard.DeleteFunc(cb) })
+}
+
+// Flush deletes all values from the cache and return the number of deleted values.
+func (s *Sharded[K, V]) Flush() int {
+	return s.sum((*Gokachu[K, V]).Flush)
+}
+
+// Keys returns all keys in the cache. Keys are grouped by shard, in eviction order within a shard. Expired keys are skipped.
+func (s *Sharded[K, V]) Keys() []K {
+	keys := []K{}
+
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+
+	return slices.Clip(keys)
+}
+
+// KeysFunc returns all keys in the cache for which the callback returns true.
+func (s *Sharded[K, V]) KeysFunc(cb func(key K, value V) bool) []K {
+	keys := []K{}
+
+	for _, shard := range s.shards {
+		keys = append(keys, shard.KeysFunc(cb)...)
+	}
+
+	return slices.Clip(keys)
+}
+
+// All returns an iterator over the keys and values in the cache, shard by shard, in eviction order within a shard.
+// Expired values are skipped.
+//
+// The read lock of the current shard is held while the loop body runs, so the body must not call methods of the cache;
+// doing so may deadlock. Use Items for a snapshot that can be processed freely.
+func (s *Sharded[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, shard := range s.shards {
+			for key, value := range shard.All() {
+				if !yield(key, value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over the keys in the cache. See All for the order and the locking rules.
+func (s *Sharded[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range s.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over the values in the cache. See All for the order and the locking rules.
+func (s *Sharded[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range s.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Items returns a snapshot of the values in the cache, grouped by shard. Expired values are skipped.
+func (s *Sharded[K, V]) Items() []Item[K, V] {
+	items := []Item[K, V]{}
+
+	for _, shard := range s.shards {
+		items = append(items, shard.Items()...)
+	}
+
+	return slices.Clip(items)
+}
+
+// Count returns the number of values in the cache. Expired values are not counted.
+func (s *Sharded[K, V]) Count() int {
+	return s.sum((*Gokachu[K, V]).Count)
+}
+
+// CountFunc returns the number of values in the cache for which the callback returns true.
+func (s *Sharded[K, V]) CountFunc(cb func(key K, value V) bool) int {
+	return s.sum(func(shard *Gokachu[K, V]) int { return shard.CountFunc(cb) })
+}
+
+// Cost returns the total cost of the values in the cache. See Config.MaxCost.
+func (s *Sharded[K, V]) Cost() int64 {
+	total := int64(0)
+
+	for _, shard := range s.shards {
+		total += shard.Cost()
+	}
+
+	return total
+}
+
+// MemoryBytes returns the approximate heap footprint of the cache. See Gokachu.MemoryBytes.
+func (s *Sharded[K, V]) MemoryBytes() int64 {
+	total := int64(0)
+
+	for _, shard := range s.shards {
+		total += shard.MemoryBytes()
+	}
+
+	return total
+}
+
+// Close closes the cache and all associated resources. Delete hooks run for each remaining value unless Config.SilentClose is set.
+// If Config.PersistPath is set, the cache is saved before its values are deleted.
+func (s *Sharded[K, V]) Close() {
+	s.mut.Lock()
+
+	if s.pollCancel == nil {
+		s.mut.Unlock()
+		return
+	}
+
+	close(s.pollCancel)
+	s.pollCancel = nil
+
+	s.mut.Unlock()
+
+	s.wg.Wait()
+
+	// saved after the periodic saves stopped, so the last state wins
+	if s.persister.enabled() {
+		s.persister.save(s.records())
+	}
+
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+}
+
+func (s *Sharded[K, V]) AddOnSetHook(hook func(key K, value V, ttl time.Duration)) uint64 {
+	return s.addHook(func(shard *Gokachu[K, V]) uint64 { return shard.AddOnSetHook(hook) })
+}
+
+func (s *Sharded[K, V]) RemoveOnSetHook(id uint64) bool {
+	return s.removeHook(id, (*Gokachu[K, V]).RemoveOnSetHook)
+}
+
+func (s *Sharded[K, V]) AddOnGetHook(hook func(key K, value V)) uint64 {
+	return s.addHook(func(shard *Gokachu[K, V]) uint64 { return shard.AddOnGetHook(hook) })
+}
+
+func (s *Sharded[K, V]) RemoveOnGetHook(id uint64) bool {
+	return s.removeHook(id, (*Gokachu[K, V]).RemoveOnGetHook)
+}
+
+func (s *Sharded[K, V]) AddOnMissHook(hook func(key K)) uint64 {
+	return s.addHook(func(shard *Gokachu[K, V]) uint64 { return shard.AddOnMissHook(hook) })
+}
+
+func (s *Sharded[K, V]) RemoveOnMissHook(id uint64) bool {
+	return s.removeHook(id, (*Gokachu[K, V]).RemoveOnMissHook)
+}
+
+func (s *Sharded[K, V]) AddOnDeleteHook(hook func(key K, value V)) uint64 {
+	return s.addHook(func(shard *Gokachu[K, V]) uint64 { return shard.AddOnDeleteHook(hook) })
+}
+
+func (s *Sharded[K, V]) RemoveOnDeleteHook(id uint64) bool {
+	return s.removeHook(id, (*Gokachu[K, V]).RemoveOnDeleteHook)
+}
+
+func (s *Sharded[K, V]) AddOnEvictHook(hook func(key K, value V, reason EvictionReason)) uint64 {
+	return s.addHook(func(shard *Gokachu[K, V]) uint64 { return shard.AddOnEvictHook(hook) })
+}
+
+func (s *Sharded[K, V]) RemoveOnEvictHook(id uint64) bool {
+	return s.removeHook(id, (*Gokachu[K, V]).RemoveOnEvictHook)
+}
+
+// shard returns the shard of the key.
+func (s *Sharded[K, V]) shard(key K) *Gokachu[K, V] {
+	return s.shards[maphash.Comparable(s.seed, key)%uint64(len(s.shards))]
+}
+
+// group groups the keys by shard.
+func (s *Sharded[K, V]) group(keys []K) map[*Gokachu[K, V]][]K {
+	groups := make(map[*Gokachu[K, V]][]K)
+
+	for _, key := range keys {
+		shard := s.shard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	return groups
+}
+
+// expire deletes expired values of every shard.
+func (s *Sharded[K, V]) expire() {
+	for _, shard := range s.shards {
+		shard.expire()
+	}
+}
+
+// sum returns the sum of the results of fn for every shard.
+func (s *Sharded[K, V]) sum(fn func(shard *Gokachu[K, V]) int) int {
+	total := 0
+
+	for _, shard := range s.shards {
+		total += fn(shard)
+	}
+
+	return total
+}
+
+// addHook adds a hook to every shard and returns a single ID for all of them.
+func (s *Sharded[K, V]) addHook(add func(shard *Gokachu[K, V]) uint64) uint64 {
+	ids := make([]uint64, len(s.shards))
+
+	for i, shard := range s.shards {
+		ids[i] = add(shard)
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	id := s.inc.Add(1)
+	s.hooks[id] = ids
+
+	return id
+}
+
+// removeHook removes a hook added by addHook from every shard.
+func (s *Sharded[K, V]) removeHook(id uint64, remove func(shard *Gokachu[K, V], id uint64) bool) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	ids, ok := s.hooks[id]
+	if !ok {
+		return false
+	}
+
+	removed := false
+
+	for i, shard := range s.shards {
+		if remove(shard, ids[i]) {
+			removed = true
+		}
+	}
+
+	if removed {
+		delete(s.hooks, id)
+	}
+
+	return removed
+}
+
+// divideUp divides n by d, rounding up.
+func divideUp[T int | int64](n, d T) T {
+	return (n + d - 1) / d
+}
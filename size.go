@@ -0,0 +1,89 @@
+package gokachu
+
+import "reflect"
+
+// Sizer is implemented by values that know their approximate heap footprint. The cache uses it for Config.MaxMemoryBytes
+// instead of estimating the size.
+type Sizer interface {
+	// SizeBytes returns the approximate number of bytes the value occupies, including the memory it references.
+	SizeBytes() int64
+}
+
+var sizerType = reflect.TypeFor[Sizer]()
+
+// entryOverhead is the approximate memory used by the cache for every entry besides the key and the value:
+// the entry itself, its map slot and a node of the eviction policy.
+const entryOverhead = 64
+
+// newSizer returns a function estimating the heap footprint of an entry. Sizer values report their own size,
+// strings and byte slices count their contents and other types count their fixed size only, so memory referenced
+// by pointers, maps and other slices is not seen.
+func newSizer[K comparable, V any]() func(key K, value V) int64 {
+	keySize, valueSize := sizeEstimator[K](), sizeEstimator[V]()
+	static := int64(reflect.TypeFor[valueWithTTL[K, V]]().Size()) + entryOverhead
+
+	return func(key K, value V) int64 {
+		return static + keySize(key) + valueSize(value)
+	}
+}
+
+// sizeEstimator returns a function estimating the memory referenced by a value of the type, excluding the fixed size
+// already counted by its container.
+func sizeEstimator[T any]() func(v T) int64 {
+	typ := reflect.TypeFor[T]()
+
+	switch {
+	case typ.Kind() == reflect.Interface:
+		// the dynamic type decides, and it is boxed outside of the container
+		return func(v T) int64 {
+			x := any(v)
+			if x == nil {
+				return 0
+			}
+
+			return dynamicSize(x)
+		}
+	case typ.Implements(sizerType):
+		return func(v T) int64 {
+			if nilPointer(v) {
+				return 0
+			}
+
+			return max(any(v).(Sizer).SizeBytes()-int64(typ.Size()), 0)
+		}
+	case typ.Kind() == reflect.String:
+		return func(v T) int64 {
+			return int64(reflect.ValueOf(v).Len())
+		}
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return func(v T) int64 {
+			return int64(reflect.ValueOf(v).Cap())
+		}
+	default:
+		return func(T) int64 { return 0 }
+	}
+}
+
+// dynamicSize estimates the memory of a boxed value.
+func dynamicSize(x any) int64 {
+	switch x := x.(type) {
+	case Sizer:
+		if nilPointer(x) {
+			return 0
+		}
+
+		return x.SizeBytes()
+	case string:
+		return int64(len(x))
+	case []byte:
+		return int64(cap(x))
+	}
+
+	return int64(reflect.TypeOf(x).Size())
+}
+
+// nilPointer reports whether the value is a nil pointer, whose SizeBytes method may dereference it.
+func nilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
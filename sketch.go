@@ -0,0 +1,90 @@
+package gokachu
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+const (
+	sketchDepth      = 4   // number of counter rows
+	sketchMaxCount   = 15  // counters saturate at this value
+	sketchSampleRate = 10  // counters are halved after width*sketchSampleRate increments
+	sketchWidthRatio = 4   // counters per row for each key of the capacity
+	sketchMinWidth   = 256 // counters per row for small caches
+)
+
+// countMinSketch estimates how often keys are seen with a fixed amount of memory.
+// Counters are halved periodically, so old popularity fades out and new popular keys can compete.
+type countMinSketch[K comparable] struct {
+	seed      maphash.Seed
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// newCountMinSketch creates a sketch for about capacity distinct keys.
+func newCountMinSketch[K comparable](capacity int) *countMinSketch[K] {
+	width := 1 << bits.Len(uint(max(capacity*sketchWidthRatio, sketchMinWidth)-1)) // next power of two
+
+	s := &countMinSketch[K]{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: width * sketchSampleRate,
+	}
+
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+
+	return s
+}
+
+// increment counts one occurrence of the key.
+func (s *countMinSketch[K]) increment(key K) {
+	h := maphash.Comparable(s.seed, key)
+
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.age()
+	}
+}
+
+// estimate returns the estimated number of occurrences of the key.
+func (s *countMinSketch[K]) estimate(key K) uint8 {
+	h := maphash.Comparable(s.seed, key)
+	count := uint8(sketchMaxCount)
+
+	for i := range s.rows {
+		count = min(count, s.rows[i][s.index(h, i)])
+	}
+
+	return count
+}
+
+// age halves every counter.
+func (s *countMinSketch[K]) age() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+
+	s.additions /= 2
+}
+
+// index returns the counter of the hash in the row. Every row remixes the hash, so keys colliding in one row rarely collide in the others.
+func (s *countMinSketch[K]) index(h uint64, row int) uint64 {
+	h += uint64(row+1) * 0x9e3779b97f4a7c15
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+
+	return (h ^ h>>31) & s.mask
+}
@@ -0,0 +1,237 @@
+package gokachu
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrInvalidSnapshot is returned by Restore for a stream that is not a snapshot of this format version or is corrupt.
+var ErrInvalidSnapshot = errors.New("gokachu: invalid snapshot")
+
+const (
+	snapshotMagic   = "gokachu"
+	snapshotVersion = 1
+)
+
+// Codec encodes and decodes the contents of a snapshot. GobCodec and JSONCodec are built in.
+//
+// A snapshot is written as a sequence of values with a single encoder and read back with a single decoder,
+// so a codec may keep state between the values of a stream, like type information.
+type Codec[K comparable, V any] interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Encoder writes the values of a snapshot. *gob.Encoder and *json.Encoder implement it.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder reads the values of a snapshot into pointers. *gob.Decoder and *json.Decoder implement it.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// GobCodec encodes snapshots with encoding/gob. Concrete types stored in interface keys or values must be registered
+// with gob.Register.
+type GobCodec[K comparable, V any] struct{}
+
+func (GobCodec[K, V]) NewEncoder(w io.Writer) Encoder {
+	return gob.NewEncoder(w)
+}
+
+func (GobCodec[K, V]) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
+
+// JSONCodec encodes snapshots with encoding/json as a stream of JSON objects. Keys and values must survive a round trip
+// through JSON, so interface keys or values are not restored with their original types.
+type JSONCodec[K comparable, V any] struct{}
+
+func (JSONCodec[K, V]) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (JSONCodec[K, V]) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// snapshotHeader is the first value of a snapshot.
+type snapshotHeader struct {
+	Magic   string
+	Version int
+	Count   int // number of records following the header
+}
+
+// snapshotRecord is a value in a snapshot. Records are written in eviction order, the next victim first.
+type snapshotRecord[K comparable, V any] struct {
+	Key        K
+	Value      V
+	ExpireTime time.Time     // zero if the value does not expire
+	TTL        time.Duration // lifetime of the value, used by Touch
+	HitCount   uint64
+}
+
+// Snapshot writes all values of the cache to w with the codec, with their remaining TTL, hit count and eviction order.
+// Expired values are skipped. The values are copied under the read lock and encoded after it is released.
+func (g *Gokachu[K, V]) Snapshot(w io.Writer, codec Codec[K, V]) error {
+	return writeSnapshot(w, codec, g.records())
+}
+
+// Restore reads a snapshot written by Snapshot from r and sets its values in the cache with their expiry time and hit count.
+// Values expired meanwhile are skipped and existing keys are overwritten. OnSet hooks are not run.
+//
+// The values are put back in eviction order. FIFO, LIFO, LRU, MRU, LFU and MFU restore the order of the snapshot exactly,
+// other strategies see the values as inserted in that order. If the snapshot does not fit into the limits of the cache,
+// the values at the front of the eviction order are evicted.
+//
+// The whole snapshot is decoded before the cache is changed, so the cache is left intact if an error is returned.
+// A stream that cannot be decoded is reported as ErrInvalidSnapshot.
+func (g *Gokachu[K, V]) Restore(r io.Reader, codec Codec[K, V]) error {
+	records, err := readSnapshot[K, V](r, codec)
+	if err != nil {
+		return err
+	}
+
+	g.restore(records)
+
+	return nil
+}
+
+// records returns the values of the cache as snapshot records in eviction order.
+func (g *Gokachu[K, V]) records() []snapshotRecord[K, V] {
+	g.syncAccesses()
+	defer g.rlock()()
+
+	return g.collectRecords()
+}
+
+// collectRecords returns the values of the cache as snapshot records in eviction order. The lock must be held.
+func (g *Gokachu[K, V]) collectRecords() []snapshotRecord[K, V] {
+	records := make([]snapshotRecord[K, V], 0, len(g.store))
+	now := time.Now()
+
+	for key := range g.policy.Keys() {
+		value := g.store[key]
+		if value.expired(now) {
+			continue
+		}
+
+		records = append(records, snapshotRecord[K, V]{
+			Key:        key,
+			Value:      value.value,
+			ExpireTime: value.expireTime,
+			TTL:        value.ttl,
+			HitCount:   value.hitCount.Load(),
+		})
+	}
+
+	return records
+}
+
+// restore sets the records in the cache in the given order.
+func (g *Gokachu[K, V]) restore(records []snapshotRecord[K, V]) {
+	defer g.lock()()
+
+	if g.pollCancel == nil {
+		return
+	}
+
+	g.applyAccesses()
+
+	policy, _ := g.policy.(restorer[K])
+	now := time.Now()
+
+	for _, record := range records {
+		if !record.ExpireTime.IsZero() && !record.ExpireTime.After(now) {
+			continue
+		}
+
+		key := record.Key
+		protected := func(k K) bool { return k == key }
+		cost, size := g.weigh(key, record.Value), g.sizer(key, record.Value)
+		_, exists := g.store[key]
+
+		// clear if the new value does not fit
+		if !exists {
+			g.makeRoom(protected, 1, cost, size)
+		}
+
+		g.put(key, record.Value, record.ExpireTime, record.TTL, cost, size, nil)
+
+		// clear if the new cost or size of the existing value does not fit
+		if exists {
+			g.makeRoom(protected, 0, 0, 0)
+		}
+
+		g.store[key].hitCount.Store(record.HitCount)
+
+		if policy != nil {
+			policy.restore(key, record.HitCount)
+		}
+	}
+}
+
+// writeSnapshot encodes the header and the records to w.
+func writeSnapshot[K comparable, V any](w io.Writer, codec Codec[K, V], records []snapshotRecord[K, V]) error {
+	enc := codec.NewEncoder(w)
+
+	err := enc.Encode(snapshotHeader{Magic: snapshotMagic, Version: snapshotVersion, Count: len(records)})
+	if err != nil {
+		return fmt.Errorf("gokachu: write snapshot: %w", err)
+	}
+
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			return fmt.Errorf("gokachu: write snapshot: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readSnapshot decodes and validates the header and the records from r.
+func readSnapshot[K comparable, V any](r io.Reader, codec Codec[K, V]) ([]snapshotRecord[K, V], error) {
+	dec := codec.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrInvalidSnapshot, unexpectedEOF(err))
+	}
+
+	switch {
+	case header.Magic != snapshotMagic:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidSnapshot, header.Magic)
+	case header.Version != snapshotVersion:
+		return nil, fmt.Errorf("%w: unsupported version %d, want %d", ErrInvalidSnapshot, header.Version, snapshotVersion)
+	case header.Count < 0:
+		return nil, fmt.Errorf("%w: negative record count %d", ErrInvalidSnapshot, header.Count)
+	}
+
+	// the count is not trusted for the allocation, a corrupt header must not exhaust memory
+	records := make([]snapshotRecord[K, V], 0, min(header.Count, 1024))
+
+	for i := range header.Count {
+		var record snapshotRecord[K, V]
+		if err := dec.Decode(&record); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %w", ErrInvalidSnapshot, i, unexpectedEOF(err))
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, as a snapshot ending early is truncated.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,85 @@
+package gokachu
+
+import "time"
+
+// TTL returns the remaining lifetime of a value. It is 0 if the value does not expire.
+// Returns false in second value if the key does not exist or is expired.
+func (g *Gokachu[K, V]) TTL(key K) (time.Duration, bool) {
+	defer g.rlock()()
+
+	now := time.Now()
+
+	value, ok := g.store[key]
+	if !ok || value.expired(now) {
+		return 0, false
+	}
+
+	if value.expireTime.IsZero() {
+		return 0, true
+	}
+
+	return value.expireTime.Sub(now), true
+}
+
+// Expire sets the TTL of a value without setting it again, so no hooks run and the eviction order does not change.
+// If the TTL is 0 or negative, the value will not expire. Returns false if the key does not exist or is expired.
+func (g *Gokachu[K, V]) Expire(key K, ttl time.Duration) bool {
+	defer g.lock()()
+
+	if ttl <= 0 {
+		return g.setExpireTime(key, time.Time{}, 0)
+	}
+
+	return g.setExpireTime(key, time.Now().Add(ttl), ttl)
+}
+
+// ExpireAt sets the expiry time of a value like Expire. If the time is zero, the value will not expire; if it has passed,
+// the value expires immediately. Returns false if the key does not exist or is expired.
+func (g *Gokachu[K, V]) ExpireAt(key K, t time.Time) bool {
+	defer g.lock()()
+
+	if t.IsZero() {
+		return g.setExpireTime(key, time.Time{}, 0)
+	}
+
+	return g.setExpireTime(key, t, max(time.Until(t), 0))
+}
+
+// Persist removes the expiry of a value, so it will not expire. Returns false if the key does not exist or is expired.
+func (g *Gokachu[K, V]) Persist(key K) bool {
+	defer g.lock()()
+
+	return g.setExpireTime(key, time.Time{}, 0)
+}
+
+// Touch restarts the lifetime of a value with the TTL it was last given by Set, Expire or ExpireAt.
+// Values without TTL are left as they are. Returns false if the key does not exist or is expired.
+func (g *Gokachu[K, V]) Touch(key K) bool {
+	defer g.lock()()
+
+	value, ok := g.store[key]
+	if !ok || value.expired(time.Now()) {
+		return false
+	}
+
+	if value.ttl > 0 {
+		value.expireTime = time.Now().Add(value.ttl)
+		g.expirations.update(value)
+	}
+
+	return true
+}
+
+// setExpireTime sets the expiry time and the TTL of a value. The write lock must be held.
+func (g *Gokachu[K, V]) setExpireTime(key K, exp time.Time, ttl time.Duration) bool {
+	value, ok := g.store[key]
+	if !ok || value.expired(time.Now()) {
+		return false
+	}
+
+	value.expireTime = exp
+	value.ttl = ttl
+	g.expirations.update(value)
+
+	return true
+}
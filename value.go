@@ -1,17 +1,64 @@
 package gokachu
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type valueWithTTL[K comparable, V any] struct {
 	key        K
 	value      V
-	hitCount   uint
+	hitCount   atomic.Uint64 // updated by Get, which may only hold the read lock
+	visits     atomic.Uint32 // access bit of SIEVE and access counter of S3-FIFO, updated without the write lock
+	cost       int64
+	size       int64 // approximate heap footprint, see Gokachu.MemoryBytes
 	expireTime time.Time
+	ttl        time.Duration // the lifetime given by Set or Expire, restarted by Touch
+	heapIndex  int           // index in the expiration heap, -1 if the value has no TTL
 
 	// Hooks
 	hook Hook
 }
 
+// expired reports whether the value is expired at the given time. Values without TTL never expire.
+func (v *valueWithTTL[K, V]) expired(now time.Time) bool {
+	return !v.expireTime.IsZero() && !v.expireTime.After(now)
+}
+
+// expireTime returns the expiry time of a value set now with the TTL. It is zero if the TTL is 0 or negative.
+func expireTime(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(ttl)
+}
+
+// item returns a snapshot of the value at the given time.
+func (v *valueWithTTL[K, V]) item(now time.Time) Item[K, V] {
+	item := Item[K, V]{
+		Key:        v.key,
+		Value:      v.value,
+		ExpireTime: v.expireTime,
+		HitCount:   v.hitCount.Load(),
+	}
+
+	if !v.expireTime.IsZero() {
+		item.TTL = v.expireTime.Sub(now)
+	}
+
+	return item
+}
+
+// Item is a snapshot of a value in the cache.
+type Item[K comparable, V any] struct {
+	Key        K
+	Value      V
+	ExpireTime time.Time     // zero if the value does not expire
+	TTL        time.Duration // remaining lifetime when the snapshot was taken, 0 if the value does not expire
+	HitCount   uint64        // number of successful Get calls since the value was first set
+}
+
 type Hook struct {
 	OnGet    func()
 	OnDelete func()